@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The cache keeps computed hashes on disk between runs so unchanged files don't need
+// to be decoded again. An entry is only trusted while the size and modification time
+// of the file are the same as when it was hashed, otherwise it is treated as a miss.
+// Entries are keyed by the absolute file path so relative paths from different
+// working directories still land on the same entry.
+
+// Bump this whenever the stored layout or the output of a hash function changes,
+// a cache written with a different version is discarded and rebuilt
+const version = 2
+
+type entry struct {
+	Size    int64
+	ModTime int64
+	// Keyed by the hash type name as a file can be hashed in multiple ways
+	Hashes map[string][]uint64
+}
+
+type cacheFile struct {
+	Version int
+	Entries map[string]*entry
+}
+
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*entry
+	dirty   bool
+}
+
+// Open a cache file at the given path. A missing file is not an error
+// and will start as an empty cache that is created on Save.
+func Open(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: make(map[string]*entry)}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data cacheFile
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return nil, fmt.Errorf("unable to read cache %s %w", path, err)
+	}
+	if data.Version != version || data.Entries == nil {
+		// Nothing to salvage here, every file will just be rehashed and the cache rewritten
+		c.dirty = true
+		return c, nil
+	}
+	c.entries = data.Entries
+	return c, nil
+}
+
+func key(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	return abs
+}
+
+// Get the cached hashes of a file for a hash type. The file info should be from
+// a stat of the file just before it would be hashed.
+func (c *Cache) Get(file, hashName string, info fs.FileInfo) ([]uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key(file)]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	hashes, ok := e.Hashes[hashName]
+	return hashes, ok
+}
+
+// Store the hashes of a file for a hash type. The file info should be the same one
+// used for the lookup so a file changing while it is being hashed is not cached as valid.
+func (c *Cache) Put(file, hashName string, info fs.FileInfo, hashes []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(file)
+	e, ok := c.entries[k]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		// Any hashes for an older version of the file are stale so start fresh
+		e = &entry{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Hashes:  make(map[string][]uint64),
+		}
+		c.entries[k] = e
+	}
+	e.Hashes[hashName] = hashes
+	c.dirty = true
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Write the cache back to it's file if anything has changed. This writes to a
+// temporary file first so an interrupted save doesn't corrupt an existing cache.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	data := cacheFile{Version: version, Entries: c.entries}
+	if err := gob.NewEncoder(f).Encode(&data); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write cache %s %w", c.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "image.jpg")
+	if err := os.WriteFile(file, []byte("not really an image"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "hashes.cache")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(file, "dct", info); ok {
+		t.Error("An empty cache should not have any entries")
+	}
+	hashes := []uint64{0xdeadbeef, 0xf00d}
+	c.Put(file, "dct", info, hashes)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := c.Get(file, "dct", info)
+	if !ok || !slices.Equal(cached, hashes) {
+		t.Error("The reloaded cache should contain the stored hashes")
+	}
+	if _, ok := c.Get(file, "dhash", info); ok {
+		t.Error("The cache should not return hashes for a different hash type")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "image.jpg")
+	if err := os.WriteFile(file, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(file)
+
+	c, _ := Open(filepath.Join(dir, "hashes.cache"))
+	c.Put(file, "dct", info, []uint64{1})
+
+	// Change the contents and push the mtime forward to be sure it differs
+	if err := os.WriteFile(file, []byte("modified contents"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(file, later, later)
+	info, _ = os.Stat(file)
+
+	if _, ok := c.Get(file, "dct", info); ok {
+		t.Error("A modified file should not be served from the cache")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/alexgQQ/dedupe"
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+// csv is a row of paths for each group and tsv a row for each file with what we know about it,
+// the json formats carry everything else we know
+var formats = []string{"csv", "tsv", "json", "ndjson"}
+
+func structured(format string) bool {
+	return format == "json" || format == "ndjson"
+}
+
+type hashJSON struct {
+	Name      string  `json:"name"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Distances can be infinite when nothing matches, which json has no number for
+type distance float64
+
+func (d distance) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(d), 0) || math.IsNaN(float64(d)) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(d))
+}
+
+// What we know about a file, anything that couldn't be read is left out
+type fileJSON struct {
+	Path     string     `json:"path"`
+	Size     int64      `json:"size,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+	Width    int        `json:"width,omitempty"`
+	Height   int        `json:"height,omitempty"`
+	Format   string     `json:"format,omitempty"`
+	Taken    *time.Time `json:"taken,omitempty"`
+	Make     string     `json:"make,omitempty"`
+	Model    string     `json:"model,omitempty"`
+}
+
+func newFileJSON(f dedupe.File) fileJSON {
+	j := fileJSON{
+		Path:   f.Path,
+		Size:   f.Size,
+		Width:  f.Width,
+		Height: f.Height,
+		Format: f.Format,
+		Make:   f.Make,
+		Model:  f.Model,
+	}
+	if !f.ModTime.IsZero() {
+		j.Modified = &f.ModTime
+	}
+	if !f.Taken.IsZero() {
+		j.Taken = &f.Taken
+	}
+	return j
+}
+
+type groupJSON struct {
+	Type  string   `json:"type,omitempty"`
+	ID    int      `json:"id"`
+	Files []string `json:"files"`
+	// The metadata of each file by their index in files
+	Metadata []fileJSON `json:"metadata"`
+	// The distance between each pair of files by their index in files
+	Distances [][]distance `json:"distances"`
+}
+
+type nearestJSON struct {
+	Type     string   `json:"type,omitempty"`
+	File     string   `json:"file"`
+	Distance distance `json:"distance"`
+}
+
+type errorJSON struct {
+	Type  string `json:"type,omitempty"`
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// What was searched for
+type searchJSON struct {
+	Type   string     `json:"type,omitempty"`
+	Hashes []hashJSON `json:"hashes"`
+	// When searching for duplicates of an image it's the first file of the group
+	Target string `json:"target,omitempty"`
+}
+
+// Everything found in one document for the json format. Each part is it's own line with a
+// type for ndjson, starting with the search itself.
+type resultsJSON struct {
+	searchJSON
+	Groups  []groupJSON   `json:"groups,omitempty"`
+	Nearest []nearestJSON `json:"nearest,omitempty"`
+	Errors  []errorJSON   `json:"errors"`
+}
+
+func newResults(hashers []hash.Hasher, target string, err error) (r resultsJSON) {
+	for _, h := range hashers {
+		r.Hashes = append(r.Hashes, hashJSON{h.Name(), h.Threshold()})
+	}
+	r.Target = target
+	r.Errors = []errorJSON{}
+	for _, e := range dedupe.LoadErrors(err) {
+		r.Errors = append(r.Errors, errorJSON{File: e.File, Error: e.Err.Error()})
+	}
+	return
+}
+
+// Write the results in the json formats, either all at once or a line for each part
+func (r resultsJSON) write(w io.Writer, format string) error {
+	enc := json.NewEncoder(w)
+	if format == "json" {
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	search := r.searchJSON
+	search.Type = "search"
+	err := enc.Encode(search)
+	for _, g := range r.Groups {
+		g.Type = "group"
+		err = errors.Join(err, enc.Encode(g))
+	}
+	for _, n := range r.Nearest {
+		n.Type = "nearest"
+		err = errors.Join(err, enc.Encode(n))
+	}
+	for _, e := range r.Errors {
+		e.Type = "error"
+		err = errors.Join(err, enc.Encode(e))
+	}
+	return err
+}
+
+func newWriter(w io.Writer, format string) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if format == "tsv" {
+		cw.Comma = '\t'
+	}
+	return cw
+}
+
+// The columns of the tsv format, a row for each file
+var tsvHeader = []string{"group", "path", "size", "modified", "width", "height", "format", "taken", "make", "model"}
+
+func tsvRow(id int, f dedupe.File) []string {
+	timestamp := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(id),
+		f.Path,
+		strconv.FormatInt(f.Size, 10),
+		timestamp(f.ModTime),
+		strconv.Itoa(f.Width),
+		strconv.Itoa(f.Height),
+		f.Format,
+		timestamp(f.Taken),
+		f.Make,
+		f.Model,
+	}
+}
+
+// Write groups of duplicates. For csv each row is the duplicates of a group and for tsv each row
+// is one of the duplicates with it's group and metadata, both leave out the target when comparing
+// against one. The metadata is read from each file as it's written, anything that can't be read
+// is left empty since the images that failed to load are already in the errors.
+func writeGroups(w io.Writer, format string, hashers []hash.Hasher, target string, groups []dedupe.Group, err error) error {
+	if structured(format) {
+		r := newResults(hashers, target, err)
+		r.Groups = []groupJSON{}
+		for i, g := range groups {
+			distances := make([][]distance, len(g.Distances))
+			for j, row := range g.Distances {
+				for _, d := range row {
+					distances[j] = append(distances[j], distance(d))
+				}
+			}
+			files, _ := dedupe.Describe(g.Files...)
+			metadata := make([]fileJSON, len(files))
+			for j, f := range files {
+				metadata[j] = newFileJSON(f)
+			}
+			r.Groups = append(r.Groups, groupJSON{ID: i, Files: g.Files, Metadata: metadata, Distances: distances})
+		}
+		return r.write(w, format)
+	}
+	cw := newWriter(w, format)
+	if format == "tsv" {
+		if e := cw.Write(tsvHeader); e != nil {
+			return e
+		}
+	}
+	for i, g := range groups {
+		files := g.Files
+		if target != "" {
+			files = files[1:]
+		}
+		if format == "csv" {
+			if e := cw.Write(files); e != nil {
+				return e
+			}
+			continue
+		}
+		described, _ := dedupe.Describe(files...)
+		for _, f := range described {
+			if e := cw.Write(tsvRow(i, f)); e != nil {
+				return e
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write the nearest images to a target with their distances. For csv and tsv each row is an
+// image and it's distance.
+func writeNearest(w io.Writer, format string, hashers []hash.Hasher, target string, results []string, distances []float64, err error) error {
+	if structured(format) {
+		r := newResults(hashers, target, err)
+		r.Nearest = []nearestJSON{}
+		for i, file := range results {
+			r.Nearest = append(r.Nearest, nearestJSON{File: file, Distance: distance(distances[i])})
+		}
+		return r.write(w, format)
+	}
+	cw := newWriter(w, format)
+	for i, file := range results {
+		if e := cw.Write([]string{file, strconv.FormatFloat(distances[i], 'f', -1, 64)}); e != nil {
+			return e
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
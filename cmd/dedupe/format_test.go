@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexgQQ/dedupe"
+	"github.com/alexgQQ/dedupe/hash"
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// A comparison against a target with one duplicate that's infinitely far from a third image,
+// along with an image that couldn't be loaded
+func testResults() ([]hash.Hasher, string, []dedupe.Group, error) {
+	groups := []dedupe.Group{{
+		Files: []string{"target.jpg", "a.jpg", "b c.jpg"},
+		Distances: [][]float64{
+			{0, 2, 4},
+			{2, 0, math.Inf(1)},
+			{4, math.Inf(1), 0},
+		},
+	}}
+	err := errors.Join(&dedupe.LoadError{File: "broken.jpg", Err: errors.New("bad header")}, errors.New("something else"))
+	return []hash.Hasher{hash.WithThreshold(hash.DCT, 12)}, "target.jpg", groups, err
+}
+
+func TestWriteGroupsCSV(t *testing.T) {
+	hashers, target, groups, err := testResults()
+	for format, want := range map[string]string{
+		"csv": "a.jpg,b c.jpg\n",
+		// Nothing can be read about files that don't exist so only their group and path are known
+		"tsv": "group\tpath\tsize\tmodified\twidth\theight\tformat\ttaken\tmake\tmodel\n" +
+			"0\ta.jpg\t0\t\t0\t0\t\t\t\t\n" +
+			"0\tb c.jpg\t0\t\t0\t0\t\t\t\t\n",
+	} {
+		var buf bytes.Buffer
+		if e := writeGroups(&buf, format, hashers, target, groups, err); e != nil {
+			t.Fatal(e)
+		}
+		if buf.String() != want {
+			t.Errorf("Expected %s without the target %q but got %q", format, want, buf.String())
+		}
+	}
+
+	// Without a target every file of the group is written
+	var buf bytes.Buffer
+	if e := writeGroups(&buf, "csv", hashers, "", groups, err); e != nil {
+		t.Fatal(e)
+	}
+	if want := "target.jpg,a.jpg,b c.jpg\n"; buf.String() != want {
+		t.Errorf("Expected %q but got %q", want, buf.String())
+	}
+}
+
+func TestWriteGroupsJSON(t *testing.T) {
+	hashers, target, groups, err := testResults()
+	var buf bytes.Buffer
+	if e := writeGroups(&buf, "json", hashers, target, groups, err); e != nil {
+		t.Fatal(e)
+	}
+	var results struct {
+		Hashes []hashJSON
+		Target string
+		Groups []struct {
+			ID        int
+			Files     []string
+			Metadata  []fileJSON
+			Distances [][]*float64
+		}
+		Errors []errorJSON
+	}
+	if e := json.Unmarshal(buf.Bytes(), &results); e != nil {
+		t.Fatalf("Expected valid json %v\n%s", e, buf.String())
+	}
+	if len(results.Hashes) != 1 || results.Hashes[0].Name != "dct" || results.Hashes[0].Threshold != 12 {
+		t.Errorf("Unexpected hashes %v", results.Hashes)
+	}
+	if results.Target != target {
+		t.Errorf("Expected the target %s but got %s", target, results.Target)
+	}
+	if len(results.Groups) != 1 || !slices.Equal(results.Groups[0].Files, groups[0].Files) {
+		t.Fatalf("Expected the group with the target first but got %v", results.Groups)
+	}
+	if metadata := results.Groups[0].Metadata; len(metadata) != 3 || metadata[1].Path != "a.jpg" || metadata[1].Modified != nil {
+		t.Errorf("Expected the metadata of each file with nothing known about missing ones but got %v", metadata)
+	}
+	distances := results.Groups[0].Distances
+	if distances[0][1] == nil || *distances[0][1] != 2 {
+		t.Error("Expected the distance between the target and a to be 2")
+	}
+	if distances[1][2] != nil || distances[2][1] != nil {
+		t.Error("Expected an infinite distance to be null")
+	}
+	// Only the images that failed to load are errors, anything else wrong isn't about an image
+	if len(results.Errors) != 1 || results.Errors[0].File != "broken.jpg" || results.Errors[0].Error != "bad header" {
+		t.Errorf("Expected the load error for broken.jpg but got %v", results.Errors)
+	}
+}
+
+func TestWriteGroupsNDJSON(t *testing.T) {
+	hashers, target, groups, err := testResults()
+	var buf bytes.Buffer
+	if e := writeGroups(&buf, "ndjson", hashers, target, groups, err); e != nil {
+		t.Fatal(e)
+	}
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var typed struct{ Type string }
+		if e := json.Unmarshal([]byte(line), &typed); e != nil {
+			t.Fatalf("Expected each line to be valid json %v\n%s", e, line)
+		}
+		types = append(types, typed.Type)
+	}
+	if want := []string{"search", "group", "error"}; !slices.Equal(types, want) {
+		t.Errorf("Expected lines of %v but got %v", want, types)
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := dedupe.File{Path: "photo.jpg", Size: 1234, ModTime: modified, Metadata: utils.Metadata{
+		Width: 40, Height: 30, Format: "jpeg", Taken: taken, Make: "Canon", Model: "EOS 5D",
+	}}
+
+	want := []string{"2", "photo.jpg", "1234", "2024-05-06T07:08:09Z", "40", "30", "jpeg", "2020-01-02T03:04:05Z", "Canon", "EOS 5D"}
+	if got := tsvRow(2, f); !slices.Equal(got, want) {
+		t.Errorf("Expected the tsv row %v but got %v", want, got)
+	}
+
+	data, err := json.Marshal(newFileJSON(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"taken":"2020-01-02T03:04:05Z"`, `"make":"Canon"`, `"model":"EOS 5D"`, `"modified":"2024-05-06T07:08:09Z"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("Expected %s in the file json %s", field, data)
+		}
+	}
+
+	// Without EXIF data there's no date taken or camera to give
+	f.Metadata = utils.Metadata{}
+	if data, _ = json.Marshal(newFileJSON(f)); strings.Contains(string(data), "taken") || strings.Contains(string(data), "make") {
+		t.Errorf("Expected missing EXIF data to be left out of %s", data)
+	}
+}
+
+func TestWriteNearest(t *testing.T) {
+	hashers, target, _, err := testResults()
+	results := []string{"a.jpg", "b.jpg"}
+	distances := []float64{1.5, math.Inf(1)}
+
+	var buf bytes.Buffer
+	if e := writeNearest(&buf, "tsv", hashers, target, results, distances, err); e != nil {
+		t.Fatal(e)
+	}
+	if want := "a.jpg\t1.5\nb.jpg\t+Inf\n"; buf.String() != want {
+		t.Errorf("Expected %q but got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	if e := writeNearest(&buf, "json", hashers, target, results, distances, err); e != nil {
+		t.Fatal(e)
+	}
+	var parsed struct {
+		Nearest []struct {
+			File     string
+			Distance *float64
+		}
+		Errors []errorJSON
+	}
+	if e := json.Unmarshal(buf.Bytes(), &parsed); e != nil {
+		t.Fatalf("Expected valid json %v\n%s", e, buf.String())
+	}
+	if len(parsed.Nearest) != 2 || parsed.Nearest[0].File != "a.jpg" || *parsed.Nearest[0].Distance != 1.5 {
+		t.Errorf("Unexpected nearest images %v", parsed.Nearest)
+	}
+	if parsed.Nearest[1].Distance != nil {
+		t.Error("Expected an infinite distance to be null")
+	}
+	if len(parsed.Errors) != 1 {
+		t.Errorf("Expected the load error but got %v", parsed.Errors)
+	}
+
+	buf.Reset()
+	if e := writeNearest(&buf, "ndjson", hashers, target, results, distances, nil); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"type":"search"`) || !strings.Contains(lines[1], `"type":"nearest"`) {
+		t.Errorf("Expected a search line then a nearest line for each image but got\n%s", buf.String())
+	}
+}
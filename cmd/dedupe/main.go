@@ -2,20 +2,25 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
+	"cmp"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alexgQQ/dedupe"
+	"github.com/alexgQQ/dedupe/cache"
 	"github.com/alexgQQ/dedupe/hash"
 	"github.com/alexgQQ/dedupe/utils"
+	"github.com/alexgQQ/dedupe/vptree"
 )
 
 func main() {
@@ -26,6 +31,10 @@ func main() {
 }
 
 func run() error {
+	// Undoing is a different enough thing that it's a command of it's own rather than a flag
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		return undo(os.Args[2:])
+	}
 
 	flag.Usage = func() {
 		msg := `
@@ -38,12 +47,48 @@ Find any duplicate images in path/to/images and other/path/to/images
 	dedupe path/to/images other/path/to/images
 Find and delete duplicate images in path/to/images and any of it's subdirectories
 	dedupe -recursive -delete path/to/images
+Find and move duplicate images in path/to/images to the trash
+	dedupe -trash path/to/images
+Replace duplicate images in path/to/images with hard links to the image kept to free up space
+	dedupe -link hard path/to/images
 Find and move duplicate images in path/to/images to duplicates dir and suppress output
 	dedupe -move duplicates -q path/to/images
+Copy duplicate images in path/to/images to duplicates dir keeping the directories they were in
+	dedupe -r -copy duplicates -layout mirror path/to/images
+Find duplicates in a large library and keep hashes around so later runs only hash new or changed files
+	dedupe -recursive -cache ~/.cache/dedupe.cache path/to/images
+Save an index of path/to/images once and later find duplicates of target/image.jpg without rehashing the directory
+	dedupe -search -save-index images.idx path/to/images
+	dedupe -index images.idx target/image.jpg
+Show the 5 most similar images to target/image.jpg in path/to/images even if none are duplicates
+	dedupe -nearest 5 target/image.jpg path/to/images
+Only treat images as duplicates when both the dct and dhash agree, with a looser dhash threshold
+	dedupe -hash dct,dhash:14 -combine all path/to/images
+Find duplicates in path/to/images even if they have been mirrored or rotated
+	dedupe -any-orientation path/to/images
+Find cropped copies of images in path/to/images where at least 2 segments of the images match
+	dedupe -segments 2 path/to/images
+Find duplicates in path/to/images ignoring any black bars or solid padding around them
+	dedupe -trim path/to/images
+Delete duplicates in path/to/images keeping the copy in path/to/images/originals, or the highest resolution one
+	dedupe -delete -keep prefer,resolution -prefer path/to/images/originals path/to/images
+Delete duplicates of the images in path/to/originals found in path/to/images without ever touching path/to/originals
+	dedupe -delete -reference path/to/originals path/to/images
+Show which images in path/to/images would be deleted and save that as json, without deleting anything
+	dedupe -delete -dry-run -plan plan.json path/to/images
+Put back the images moved by an earlier run from the journal it wrote
+	dedupe undo ~/.cache/dedupe/journal-20240102-150405-123456789.jsonl
+Find duplicates where every image in a group is similar to every other image in it
+	dedupe -group strict path/to/images
+Output duplicates in path/to/images as json along with the distances between them and any images that couldn't be loaded
+	dedupe -format json path/to/images > duplicates.json
+Review duplicates in path/to/images in a browser before deleting anything
+	dedupe -delete -dry-run -report report.html path/to/images
 Read images from a file listing and output any duplicates found in a csv like format
 	cat images.txt | dedupe --search -o - > duplicates.csv`
 		fmt.Fprintln(flag.CommandLine.Output(), "dedupe is a program for discovering and managing duplicate images")
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s [-r|-v|-m <dir>|-c <dir>|-d|-o|-q|-hash|-search|-delete-all|-threshold <integer>] <image|-|dir> [<image|dir> ...] \n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s [-r|-v|-m <dir>|-c <dir>|-layout <mode>|-verify|-format <format>|-report <file>|-d|-trash|-link <mode>|-o|-q|-hash|-search|-delete-all|-threshold <integer>|-cache <file>|-group <mode>|-keep <list>|-prefer <dir>|-reference <dir>|-dry-run|-plan <file>|-journal <file>|-any-orientation|-segments <integer>|-trim|-ignore-exif-orientation|-trim-tolerance <integer>|-combine <mode>|-weights <list>|-nearest <integer>|-index <file>|-save-index <file>] <image|-|dir> [<image|dir> ...] \n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s undo <journal> [<journal> ...]\n", os.Args[0])
 		flag.PrintDefaults()
 		fmt.Fprintln(flag.CommandLine.Output(), msg)
 	}
@@ -58,12 +103,42 @@ Read images from a file listing and output any duplicates found in a csv like fo
 	var copy string
 	var delete bool
 	var deleteAll bool
+	var trash bool
+	var link string
+	var layout string
+	var verify bool
+	var format string
+	var reportPath string
 	var hashName string
 	var threshold int
 	var version bool
+	var cachePath string
+	var indexPath string
+	var saveIndexPath string
+	var nearest int
+	var groupName string
+	var combineName string
+	var weightList string
+	var anyOrientation bool
+	var segments int
+	var trim bool
+	var trimTolerance int
+	var ignoreExifOrientation bool
+	var keep string
+	var preferred []string
+	var references dedupe.References
+	var dryRun bool
+	var planPath string
+	var journalPath string
 
 	flag.BoolVar(&output, "output", false, "Suppress info output and only output results. Intended to be used for piping output to a file or process")
 	flag.BoolVar(&output, "o", false, "alias for -output")
+	flag.StringVar(&reportPath, "report", "", "Write a page to review the duplicates in a browser to the provided html file, with a thumbnail, "+
+		"size, dimensions and EXIF date and camera of each image, the distances between them and which would be kept")
+	flag.StringVar(&format, "format", "csv", fmt.Sprintf("The format of the results. Available options are %s. "+
+		"csv is a row of images for each group and tsv a row for each image with it's group, size, dimensions and EXIF date and camera. "+
+		"Both are a row for each image and it's distance for -nearest. "+
+		"json and ndjson also have the metadata of each image, the distances between them, the hash and threshold used and any images that couldn't be loaded", strings.Join(formats, ", ")))
 
 	flag.BoolVar(&quiet, "quiet", false, "Suppress all output")
 	flag.BoolVar(&quiet, "q", false, "alias for -quiet")
@@ -78,19 +153,77 @@ Read images from a file listing and output any duplicates found in a csv like fo
 
 	flag.StringVar(&move, "move", "", "Move duplicate images to a the provided directory. The provided path will be created if it doesn't exist")
 	flag.StringVar(&move, "m", "", "alias for -move")
-	flag.StringVar(&copy, "copy", "", "Same as move but will copy files instead")
+	flag.StringVar(&copy, "copy", "", "Same as move but will copy files instead. They are hard linked when on the same filesystem and copied otherwise")
 	flag.StringVar(&copy, "c", "", "alias for -copy")
+	flag.BoolVar(&verify, "verify", false, "Check each copy matches the original when it can't be hard linked and has to be copied, like on another filesystem")
+	layouts := slices.Sorted(maps.Keys(utils.Layouts))
+	flag.StringVar(&layout, "layout", "suffix", fmt.Sprintf("How images are laid out in the -move or -copy directory. Available options are %s. "+
+		"suffix adds a number to the name of images with the same name and mirror keeps the directories they were in. "+
+		"A manifest.csv of where each image came from is written there too", strings.Join(layouts, ", ")))
 
-	flag.BoolVar(&delete, "delete", false, "Delete all secondary instances of duplicates found")
+	flag.BoolVar(&delete, "delete", false, "Delete all secondary instances of duplicates found, keeping the first one of each group as chosen by -keep")
 	flag.BoolVar(&delete, "d", false, "alias for -delete")
-	flag.BoolVar(&deleteAll, "delete-all", false, "Delete all instances of duplicate images found")
+	flag.BoolVar(&deleteAll, "delete-all", false, "Delete or trash all instances of duplicate images found")
+	linkModes := slices.Sorted(maps.Keys(utils.LinkModes))
+	flag.StringVar(&link, "link", "", fmt.Sprintf("Replace all secondary instances of duplicates with links to the first one to save space while keeping their paths. "+
+		"Available options are %s, reflinks fall back to hard links where the filesystem doesn't support them", strings.Join(linkModes, ", ")))
+	flag.BoolVar(&trash, "trash", false, "Same as delete but moves files to the trash so they can be restored from a file manager, or with dedupe undo")
+
+	rankings := slices.Sorted(maps.Keys(dedupe.Rankings))
+	flag.StringVar(&keep, "keep", "resolution,size", fmt.Sprintf("Comma separated policies for which image of a group is kept, each one breaking the ties of the last. "+
+		"The kept image is the first one of each group in the output and is left alone by -delete. "+
+		"Images are only ranked when one is kept by -move, -copy, -delete, -trash, -link or -report, or this is given. Available options are %s and prefer", strings.Join(rankings, ", ")))
+	flag.Func("prefer", "Keep images under this directory over others when using -keep prefer. Can be given several times with the first taking priority", func(dir string) error {
+		preferred = append(preferred, dir)
+		return nil
+	})
+	flag.Func("reference", "Search the images in this directory too but never move or delete them, and always keep them over their duplicates elsewhere. Can be given several times", func(dir string) error {
+		if _, _, isDir := utils.ImageOrDir(dir); !isDir {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		references = append(references, dir)
+		return nil
+	})
+
+	flag.BoolVar(&dryRun, "dry-run", false, "Print what -delete, -trash, -link, -move or -copy would do to each file without doing any of it")
+	flag.StringVar(&planPath, "plan", "", "Write the actions taken on files to the provided file as json, or - for stdout. Combine with -dry-run to review them first")
+
+	flag.StringVar(&journalPath, "journal", "", "Where to record the files moved or deleted so they can be put back with dedupe undo. "+
+		"The file must not already exist. Defaults to a new file in the user cache directory for each run")
 
 	flag.BoolVar(&search, "search", false, "Force a search for any duplicates against the images provided")
+	flag.IntVar(&nearest, "nearest", 0, "Find this many of the most similar images to an image target regardless of the threshold and output them with their distances")
 	flag.IntVar(&threshold, "threshold", 0, "Set the threshold score for search criteria. Smaller values are more restrictive in results.")
 
-	hashTypes := slices.Sorted(maps.Keys(hash.HashTypes))
-	opts := strings.Join(hashTypes, ", ")
-	flag.StringVar(&hashName, "hash", "dct", fmt.Sprintf("Which type of hash to use for searching. Available options are %s", opts))
+	flag.BoolVar(&anyOrientation, "any-orientation", false, "Match images that have been mirrored or rotated by 90 degrees. Hashing takes eight times as long")
+
+	flag.IntVar(&segments, "segments", 0, "Hash the light and dark segments of images instead of the whole image to find cropped copies. "+
+		"Images are duplicates when at least this many segments match. Unless a threshold is given it's half the usual one for the hash since segments look alike more easily")
+
+	flag.BoolVar(&trim, "trim", false, "Trim uniform borders like letterboxing or padding from images before hashing them")
+	flag.IntVar(&trimTolerance, "trim-tolerance", 16, "How far from the border colour a pixel can be and still be trimmed, from 0 to 255")
+
+	flag.BoolVar(&ignoreExifOrientation, "ignore-exif-orientation", false, "Hash images as they are stored instead of rotating or flipping them upright by their EXIF orientation first")
+
+	flag.StringVar(&cachePath, "cache", "", "Store computed hashes in the provided file and reuse them on later runs for any files that haven't changed")
+
+	flag.StringVar(&indexPath, "index", "", "Query a previously saved index instead of hashing images. Only an image target is needed to compare against it, or nothing to search it for duplicates")
+	flag.StringVar(&saveIndexPath, "save-index", "", "Save an index of the hashed images to the provided file so it can be queried later with -index")
+
+	groupModes := slices.Sorted(maps.Keys(dedupe.GroupModes))
+	flag.StringVar(&groupName, "group", "greedy", fmt.Sprintf("How duplicates are grouped together. Available options are %s. "+
+		"greedy is fastest but can split chains of similar images differently between runs, "+
+		"connected groups any chain of similar images together and strict only groups images that are all similar to each other", strings.Join(groupModes, ", ")))
+
+	hashNames := hash.Names()
+	opts := strings.Join(hashNames, ", ")
+	flag.StringVar(&hashName, "hash", "dct", fmt.Sprintf("Which type of hash to use for searching. Available options are %s. "+
+		"Several can be given separated by commas to match on all of them at once, each with an optional threshold like dct:18", opts))
+
+	combines := slices.Sorted(maps.Keys(vptree.Combines))
+	flag.StringVar(&combineName, "combine", "all", fmt.Sprintf("How several hashes have to agree for images to be duplicates. Available options are %s. "+
+		"all needs every hash within it's threshold, any needs only one and weighted averages how close each is to it's threshold", strings.Join(combines, ", ")))
+	flag.StringVar(&weightList, "weights", "", "Comma separated positive weights for each hash, only used with -combine weighted. Defaults to equal weights")
 
 	flag.Parse()
 
@@ -104,8 +237,12 @@ Read images from a file listing and output any duplicates found in a csv like fo
 		return nil
 	}
 
+	if indexPath != "" && saveIndexPath != "" {
+		return errors.New("an index can't be saved while querying one, -index and -save-index can't be used together")
+	}
+
 	args := flag.Args()
-	if len(args) <= 0 {
+	if len(args) <= 0 && indexPath == "" {
 		return errors.New("no arguments provided")
 	} else if slices.Contains(args, "-") {
 		scanner := bufio.NewScanner(os.Stdin)
@@ -119,6 +256,10 @@ Read images from a file listing and output any duplicates found in a csv like fo
 		targets = args
 	}
 
+	if !slices.Contains(formats, format) {
+		return fmt.Errorf("unknown output format %s", format)
+	}
+
 	var logLevel = new(slog.LevelVar)
 	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})
 	slog.SetDefault(slog.New(h))
@@ -128,16 +269,114 @@ Read images from a file listing and output any duplicates found in a csv like fo
 		logLevel.Set(slog.LevelWarn)
 	}
 
-	var hashType hash.HashType
-	if !slices.Contains(hashTypes, hashName) {
-		slog.Error("Invalid hash type provided", "hashName", hashName)
-		hashType = hash.DCT
-	} else {
-		hashType = hash.HashTypes[hashName]
+	hashers, err := parseHashers(hashName)
+	if err != nil {
+		return err
+	}
+	hasher := hashers[0]
+	if len(hashers) > 1 {
+		if threshold > 0 {
+			slog.Warn("The threshold is ignored when using several hashes, set one for each like dct:18 instead")
+		}
+		if indexPath != "" || saveIndexPath != "" || nearest > 0 || segments > 0 {
+			return errors.New("indexes, nearest searches and segments only work with a single hash")
+		}
+	} else if threshold > 0 {
+		hasher = hash.WithThreshold(hasher, float64(threshold))
+	} else if segments > 0 {
+		hasher = hash.WithThreshold(hasher, hasher.Threshold()/2)
+	}
+
+	combine, ok := vptree.Combines[combineName]
+	if !ok {
+		slog.Error("Invalid combine mode provided", "combine", combineName)
+		combine = vptree.All
+	}
+	var weights []float64
+	if weightList != "" {
+		if combine != vptree.Weighted {
+			return errors.New("weights are only used with -combine weighted")
+		}
+		for _, w := range strings.Split(weightList, ",") {
+			weight, err := strconv.ParseFloat(w, 64)
+			if err != nil {
+				return fmt.Errorf("invalid weight %s %w", w, err)
+			}
+			weights = append(weights, weight)
+		}
+		if err := vptree.CheckWeights(weights, len(hashers)); err != nil {
+			return err
+		}
+	}
+
+	keepRankings, err := dedupe.ParseRankings(keep, preferred...)
+	if err != nil {
+		return err
+	}
+	if len(references) > 0 {
+		keepRankings = append([]dedupe.Ranking{references.Ranking()}, keepRankings...)
+	}
+
+	action := actions{
+		move:       move,
+		copy:       copy,
+		delete:     delete,
+		deleteAll:  deleteAll,
+		trash:      trash,
+		verify:     verify,
+		references: references,
+	}
+	if link != "" {
+		op, ok := utils.LinkModes[link]
+		if !ok {
+			return fmt.Errorf("unknown link mode %s", link)
+		}
+		action.link = &op
+	}
+	if action.layout, ok = utils.Layouts[layout]; !ok {
+		return fmt.Errorf("unknown layout %s", layout)
 	}
 
-	if threshold > 0 {
-		hashType.Threshold = float64(threshold)
+	grouping, ok := dedupe.GroupModes[groupName]
+	if !ok {
+		slog.Error("Invalid group mode provided", "group", groupName)
+		grouping = dedupe.Greedy
+	}
+
+	deduper := dedupe.Deduper{
+		Hasher:                hasher,
+		Grouping:              grouping,
+		AnyOrientation:        anyOrientation,
+		TrimBorders:           trim,
+		TrimTolerance:         trimTolerance,
+		IgnoreExifOrientation: ignoreExifOrientation,
+	}
+	// Ranking reads the metadata of every duplicate, which is only worth it when one of them is
+	// kept over the others or the order was asked for. Otherwise a file that can't be read would
+	// fail a plain search for nothing.
+	keepGiven := false
+	flag.Visit(func(f *flag.Flag) { keepGiven = keepGiven || f.Name == "keep" })
+	if action.keeps() || reportPath != "" || keepGiven {
+		deduper.Keep = keepRankings
+	}
+	if segments > 0 {
+		if indexPath != "" || saveIndexPath != "" || nearest > 0 {
+			return errors.New("indexes and nearest searches don't work with segments")
+		}
+		deduper.Segments = segments
+	}
+	if len(hashers) > 1 {
+		deduper.Hashers = hashers
+		deduper.Combine = combine
+		deduper.Weights = weights
+	}
+	if cachePath != "" {
+		c, err := cache.Open(cachePath)
+		if err != nil {
+			return err
+		}
+		deduper.Cache = c
+		slog.Info("Loaded hash cache", "path", cachePath, "entries", c.Len())
 	}
 
 	var files []string
@@ -156,83 +395,367 @@ Read images from a file listing and output any duplicates found in a csv like fo
 			files = append(files, images...)
 		}
 	}
+	// These go after the targets so an image target is still first, files from them are told
+	// apart later on by their path. They might already be under one of the targets too.
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		seen[filepath.Clean(file)] = true
+	}
+	for _, ref := range references {
+		for _, file := range utils.FindImages(ref, recursive) {
+			if !seen[filepath.Clean(file)] {
+				seen[filepath.Clean(file)] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	var idx *vptree.Index
+	if indexPath != "" {
+		if idx, err = loadIndex(indexPath); err != nil {
+			return err
+		}
+		if threshold > 0 {
+			idx.Hasher = hash.WithThreshold(idx.Hasher, float64(threshold))
+		}
+		slog.Info("Loaded index", "path", indexPath, "hash", idx.Hasher.Name(), "threshold", idx.Hasher.Threshold(), "options", idx.Options)
+	}
 
 	var duplicates [][]string
 	var results []string
+	var distances []float64
 	var total int
-	var err error
-	if len(files) <= 1 {
+	compare := imgTarget && !search
+	if nearest > 0 {
+		if !imgTarget {
+			return errors.New("an image target is required to find the nearest images")
+		}
+		compare = true
+	}
+	if idx == nil && saveIndexPath != "" {
+		if len(files) <= 1 {
+			return errors.New("not enough images provided")
+		}
+		indexed := files
+		if compare {
+			indexed = files[1:]
+		}
+		idx, err = deduper.BuildIndex(indexed)
+		if e := saveIndex(idx, saveIndexPath); e != nil {
+			e = fmt.Errorf("unable to save index %s %w", saveIndexPath, e)
+			err = errors.Join(err, e)
+		}
+	}
+
+	var groups []dedupe.Group
+	if idx != nil {
+		if nearest > 0 {
+			var e error
+			results, distances, e = deduper.NearestIndex(idx, files[0], nearest)
+			err = errors.Join(err, e)
+		} else if compare {
+			group, e := deduper.CompareGroupIndex(idx, files[0])
+			err = errors.Join(err, e)
+			if group.Files != nil {
+				groups = append(groups, group)
+			}
+		} else if anyOrientation && !idx.Options.AnyOrientation {
+			return errors.New("the index was saved without -any-orientation so it can't match duplicates in any orientation, save it again with -any-orientation")
+		} else {
+			var e error
+			groups, total, e = deduper.DuplicateGroupsIndex(idx)
+			err = errors.Join(err, e)
+		}
+	} else if len(files) <= 1 {
 		return errors.New("not enough images provided")
-	} else if imgTarget && !search {
-		results, err = dedupe.Compare(hashType, files[0], files[1:]...)
-		if results != nil {
-			duplicates = append(duplicates, results)
-			total = len(results)
+	} else if nearest > 0 {
+		results, distances, err = deduper.Nearest(files[0], nearest, files[1:]...)
+	} else if compare {
+		var group dedupe.Group
+		group, err = deduper.CompareGroup(files[0], files[1:]...)
+		if group.Files != nil {
+			groups = append(groups, group)
 		}
 	} else {
-		duplicates, total, err = dedupe.Duplicates(hashType, files)
+		groups, total, err = deduper.DuplicateGroups(files)
+	}
+	for _, group := range groups {
+		// The target leads a compared group but it's not one of the duplicates found
+		if compare {
+			group.Files = group.Files[1:]
+			total = len(group.Files)
+		}
+		duplicates = append(duplicates, group.Files)
+	}
+	if deduper.Cache != nil {
+		if e := deduper.Cache.Save(); e != nil {
+			e = fmt.Errorf("unable to save hash cache %s %w", cachePath, e)
+			err = errors.Join(err, e)
+		}
 	}
 
-	if output || quiet {
+	if output || quiet || structured(format) {
 		// io.Discard seems to be of the proper type but does not compile
 		// so I'm doing this instead
 		defaultWriter, _ = os.Open(os.DevNull)
 		defer defaultWriter.Close()
 	}
+	resultWriter := io.Writer(os.Stdout)
+	if quiet {
+		resultWriter = defaultWriter
+	}
+	searched := hashers
+	if idx != nil {
+		searched = []hash.Hasher{idx.Hasher}
+	} else if len(hashers) == 1 {
+		searched = []hash.Hasher{hasher}
+	}
+	var target string
+	if compare {
+		target = files[0]
+	}
+
+	if nearest > 0 {
+		if len(results) == 0 {
+			fmt.Fprintln(defaultWriter, "No images found")
+		} else {
+			fmt.Fprintf(defaultWriter, "These %d images are the most similar to %s\n", len(results), target)
+		}
+		if e := writeNearest(resultWriter, format, searched, target, results, distances, err); e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to format %s output %w", format, e))
+		}
+		return err
+	}
 	if total == 0 {
 		fmt.Fprintln(defaultWriter, "No duplicate images found")
+	} else if compare {
+		fmt.Fprintf(defaultWriter, "These %d images are duplicates of %s\n", total, files[0])
+	} else {
+		fmt.Fprintf(defaultWriter, "These %d images are duplicates\n", total)
+	}
+	// The json formats are written even without any duplicates so there's always something to parse
+	if total > 0 || structured(format) {
+		if e := writeGroups(resultWriter, format, searched, target, groups, err); e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to format %s output %w", format, e))
+		}
+	}
+	plan, e := action.plan(duplicates)
+	err = errors.Join(err, e)
+	if reportPath != "" {
+		if e := writeReport(reportPath, searched, target, groups, references, plan, err); e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to write report %s %w", reportPath, e))
+		} else {
+			fmt.Fprintf(defaultWriter, "Saved a report of the duplicates to %s\n", reportPath)
+		}
+	}
+	if total == 0 {
 		// I think it makes sense to return an error so a return code can be
 		// sent specifically for no duplicates case
 		return err
 	}
-	if imgTarget && !search {
-		fmt.Fprintf(defaultWriter, "These %d images are duplicates of %s\n", total, files[0])
-	} else {
-		fmt.Fprintf(defaultWriter, "These %d images are duplicates\n", total)
+
+	if planPath != "" {
+		if e := writePlan(plan, planPath); e != nil {
+			e = fmt.Errorf("unable to save plan %s %w", planPath, e)
+			err = errors.Join(err, e)
+		}
+	}
+	if dryRun {
+		if len(plan) > 0 {
+			fmt.Fprintf(defaultWriter, "These %d actions would be taken\n", len(plan))
+		}
+		if !quiet && !structured(format) {
+			plan.Print(os.Stdout)
+		}
+		return err
+	}
+	if dest := cmp.Or(move, copy); dest != "" && len(plan) > 0 {
+		// Like the journal this is written first so it's there even if the run is interrupted
+		if e := writeManifest(plan, dest); e != nil {
+			return errors.Join(err, fmt.Errorf("unable to write manifest to %s %w", dest, e))
+		}
+	}
+	if !slices.ContainsFunc(plan, func(a utils.Action) bool { return a.Op.Destructive() }) {
+		return errors.Join(err, plan.Run())
+	}
+	// Nothing is touched if there's nowhere to record it
+	journal, e := createJournal(journalPath)
+	if e != nil {
+		return errors.Join(err, fmt.Errorf("unable to create undo journal %w", e))
+	}
+	journalPath = journal.Name()
+	err = errors.Join(err, plan.RunJournal(journal))
+	if e := journal.Close(); e != nil {
+		err = errors.Join(err, fmt.Errorf("unable to save undo journal %s %w", journalPath, e))
 	}
+	fmt.Fprintf(defaultWriter, "Saved a journal of the changes to %s\n", journalPath)
+	return err
+}
 
-	var w *csv.Writer
-	if quiet {
-		w = csv.NewWriter(defaultWriter)
-	} else {
-		w = csv.NewWriter(os.Stdout)
+// Each run gets a new journal so undoing one can't put back the files of another. Without a path
+// they are kept with the user's cache, named by when the run was so they sort in order and with
+// a random suffix so runs started in the same second don't share one.
+func createJournal(path string) (*os.File, error) {
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "dedupe")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, fmt.Sprintf("journal-%s-*.jsonl", time.Now().Format("20060102-150405")))
+}
+
+// Put back the files moved by the runs that wrote the given journals
+func undo(args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("usage: dedupe undo <journal> [<journal> ...]")
 	}
-	for _, group := range duplicates {
-		if e := w.Write(group); e != nil {
-			e = fmt.Errorf("unable to format csv output %w", e)
+	// Undo the latest run first in case they touched the same files
+	for _, path := range slices.Backward(args) {
+		f, e := os.Open(path)
+		if e != nil {
 			err = errors.Join(err, e)
+			continue
+		}
+		entries, e := utils.ReadJournal(f)
+		f.Close()
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to read journal %s %w", path, e))
+			continue
 		}
+		err = errors.Join(err, utils.Undo(entries))
 	}
-	w.Flush()
+	return
+}
 
-	if move != "" {
-		for i, files := range duplicates {
-			parent := filepath.Join(move, fmt.Sprintf("group%d", i))
-			os.MkdirAll(parent, 0750)
-			if e := utils.MoveFiles(files, parent); e != nil {
-				e = fmt.Errorf("unable to move files %s to %s %w", files, parent, e)
-				err = errors.Join(err, e)
-			}
+// The action chosen with the flags, only one of them is taken
+type actions struct {
+	move       string
+	copy       string
+	delete     bool
+	deleteAll  bool
+	trash      bool
+	link       *utils.Operation
+	layout     utils.Layout
+	verify     bool
+	references dedupe.References
+}
+
+// Whether the action treats the first file of each group as the one kept
+func (a actions) keeps() bool {
+	return a.move != "" || a.copy != "" || a.link != nil || ((a.delete || a.trash) && !a.deleteAll)
+}
+
+// Work out everything the chosen action will do to the duplicates before any of it is done
+func (a actions) plan(duplicates [][]string) (plan utils.Plan, err error) {
+	var root string
+	if a.layout == utils.Mirror {
+		if root, err = utils.CommonDir(slices.Concat(duplicates...)); err != nil {
+			return
 		}
-	} else if copy != "" {
-		for i, files := range duplicates {
-			parent := filepath.Join(copy, fmt.Sprintf("group%d", i))
-			os.MkdirAll(parent, 0750)
-			if e := utils.CopyFiles(files, parent); e != nil {
-				e = fmt.Errorf("unable to copy files %s to %s %w", files, parent, e)
-				err = errors.Join(err, e)
+	}
+	for i, files := range duplicates {
+		var planned utils.Plan
+		var e error
+		if a.move != "" {
+			planned, e = utils.PlanMove(a.references.Actionable(files, true), filepath.Join(a.move, fmt.Sprintf("group%d", i)), a.layout, root)
+		} else if a.copy != "" {
+			planned, e = utils.PlanCopy(files, filepath.Join(a.copy, fmt.Sprintf("group%d", i)), a.layout, root)
+			for j := range planned {
+				planned[j].Verify = a.verify
 			}
+		} else if a.link != nil {
+			// The first file is the one kept, everything else links to it
+			planned = utils.PlanLink(a.references.Actionable(files, false), files[0], *a.link)
+		} else if a.trash {
+			planned, e = utils.PlanTrash(a.references.Actionable(files, a.deleteAll))
+		} else if a.delete {
+			planned = utils.PlanDelete(a.references.Actionable(files, a.deleteAll))
 		}
-	} else if delete {
-		for _, files := range duplicates {
-			if !deleteAll {
-				files = files[1:]
-			}
-			if e := utils.DeleteFiles(files); e != nil {
-				e = fmt.Errorf("unable to delete files %s %w", files, e)
-				err = errors.Join(err, e)
+		err = errors.Join(err, e)
+		plan = append(plan, planned...)
+	}
+	return
+}
+
+// Add where each file is moved or copied to onto the manifest in the destination
+func writeManifest(plan utils.Plan, dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "manifest.csv")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if err := plan.WriteManifest(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writePlan(plan utils.Plan, path string) error {
+	if path == "-" {
+		return plan.WriteJSON(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := plan.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func loadIndex(path string) (*vptree.Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return vptree.Load(f)
+}
+
+func saveIndex(idx *vptree.Index, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := idx.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Parse a comma separated list of hash names, each with an optional threshold like dct:18
+func parseHashers(names string) (hashers []hash.Hasher, err error) {
+	for _, name := range strings.Split(names, ",") {
+		name, threshold, hasThreshold := strings.Cut(name, ":")
+		hasher, ok := hash.Lookup(name)
+		if !ok {
+			slog.Error("Invalid hash type provided", "hashName", name)
+			hasher = hash.DCT
+		}
+		if hasThreshold {
+			t, err := strconv.ParseFloat(threshold, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold for %s %w", name, err)
 			}
+			hasher = hash.WithThreshold(hasher, t)
 		}
+		hashers = append(hashers, hasher)
 	}
-	return err
+	return
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+func TestCreateJournal(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// Runs in the same second still get their own journal
+	a, err := createJournal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := createJournal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if a.Name() == b.Name() {
+		t.Errorf("Expected each run to have a new journal but both are %s", a.Name())
+	}
+	if matched, _ := filepath.Match("journal-*-*-*.jsonl", filepath.Base(a.Name())); !matched {
+		t.Errorf("Expected the journal to be named by when it was made but got %s", a.Name())
+	}
+
+	// A given journal is never added on to
+	path := filepath.Join(t.TempDir(), "nested", "journal.jsonl")
+	f, err := createJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f, err := createJournal(path); err == nil {
+		f.Close()
+		t.Error("Expected a journal that already exists to be an error")
+	}
+}
+
+func TestActionKeeps(t *testing.T) {
+	link := utils.HardLink
+	for name, tc := range map[string]struct {
+		action actions
+		keeps  bool
+	}{
+		"search":     {actions{}, false},
+		"move":       {actions{move: "dir"}, true},
+		"copy":       {actions{copy: "dir"}, true},
+		"link":       {actions{link: &link}, true},
+		"delete":     {actions{delete: true}, true},
+		"trash":      {actions{trash: true}, true},
+		"delete all": {actions{delete: true, deleteAll: true}, false},
+	} {
+		if tc.action.keeps() != tc.keeps {
+			t.Errorf("Expected %s keeping a file to be %v", name, tc.keeps)
+		}
+	}
+}
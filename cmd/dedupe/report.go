@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alexgQQ/dedupe"
+	"github.com/alexgQQ/dedupe/hash"
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// Thumbnails fit in a square this big
+const thumbnailSize = 200
+
+// Everything is in the one file so it can be opened or sent anywhere, thumbnails included
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dedupe report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.group { border: 1px solid #ccc; border-radius: 4px; padding: 1em; margin-bottom: 2em; }
+.files { display: flex; flex-wrap: wrap; gap: 1em; }
+.file { width: {{.Size}}px; font-size: 0.85em; word-break: break-all; }
+.file img, .missing { width: {{.Size}}px; height: {{.Size}}px; object-fit: contain; background: #eee; display: block; }
+.missing { display: flex; align-items: center; justify-content: center; color: #888; }
+.keep { outline: 3px solid #2a2; }
+.tag { display: inline-block; padding: 0 0.4em; border-radius: 3px; background: #ddd; margin: 0.2em 0.2em 0 0; }
+.keep .tag.keeper { background: #2a2; color: white; }
+table { border-collapse: collapse; font-size: 0.85em; margin-top: 0.5em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: right; }
+.error { color: #a22; }
+</style>
+</head>
+<body>
+<h1>dedupe report</h1>
+<p>
+{{range .Hashes}}Hash {{.Name}} with a threshold of {{.Threshold}}. {{end}}
+{{if .Target}}Duplicates of {{.Target}}. {{end}}
+{{len .Groups}} groups of duplicates found.
+</p>
+{{range .Groups}}
+<div class="group">
+<h2>Group {{.ID}}</h2>
+<div class="files">
+{{range .Files}}
+<div class="file{{if .Keep}} keep{{end}}">
+{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="{{.Path}}">{{else}}<div class="missing">no preview</div>{{end}}
+<div>{{if .Keep}}<span class="tag keeper">keep</span>{{end}}{{if .Target}}<span class="tag">target</span>{{end}}{{if .Reference}}<span class="tag">reference</span>{{end}}{{if .Action}}<span class="tag">{{.Action}}</span>{{end}}</div>
+<div>{{.Path}}</div>
+<div>{{.Width}}x{{.Height}} {{.Format}} {{.Bytes}}</div>
+{{with .TakenAt}}<div>Taken {{.}}</div>{{end}}
+{{with .Camera}}<div>{{.}}</div>{{end}}
+{{if .Distance}}<div>{{.Distance}} from the best image</div>{{end}}
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+</div>
+{{end}}
+</div>
+<details>
+<summary>Distances</summary>
+<table>
+<tr><th></th>{{range .Files}}<th>{{.Index}}</th>{{end}}</tr>
+{{range $i, $row := .Distances}}<tr><th>{{$i}}</th>{{range $row}}<td>{{.}}</td>{{end}}</tr>
+{{end}}
+</table>
+</details>
+</div>
+{{end}}
+{{if .Errors}}
+<h2>Images that couldn't be loaded</h2>
+<ul>{{range .Errors}}<li class="error">{{.File}} {{.Err}}</li>{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+type reportFile struct {
+	dedupe.File
+	Index     int
+	Thumbnail template.URL
+	Keep      bool
+	Target    bool
+	Reference bool
+	// What the chosen action does to the file, if anything
+	Action   string
+	Distance string
+	Error    error
+}
+
+// The file size in a readable unit
+func (f reportFile) Bytes() string {
+	size := float64(f.Size)
+	for _, unit := range []string{"B", "KB", "MB", "GB"} {
+		if size < 1024 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return ""
+}
+
+// When the photo was taken from it's EXIF data, if there is any
+func (f reportFile) TakenAt() string {
+	if f.Taken.IsZero() {
+		return ""
+	}
+	return f.Taken.Format("2006-01-02 15:04:05")
+}
+
+// The camera make and model from the EXIF data, if there is any
+func (f reportFile) Camera() string {
+	return strings.TrimSpace(f.Make + " " + f.Model)
+}
+
+type reportGroup struct {
+	ID        int
+	Files     []reportFile
+	Distances [][]string
+}
+
+type report struct {
+	Size   int
+	Hashes []hashJSON
+	Target string
+	Groups []reportGroup
+	Errors []*dedupe.LoadError
+}
+
+// Write a page to review the duplicates with a thumbnail and details of each image. The first
+// duplicate of each group is the best of them, after the target when comparing, and is the one
+// marked to keep unless the plan moves or removes it too.
+func writeReport(path string, hashers []hash.Hasher, target string, groups []dedupe.Group, references dedupe.References, plan utils.Plan, err error) error {
+	r := report{Size: thumbnailSize, Target: target, Errors: dedupe.LoadErrors(err)}
+	for _, h := range hashers {
+		r.Hashes = append(r.Hashes, hashJSON{h.Name(), h.Threshold()})
+	}
+	actions := make(map[string]utils.Action)
+	for _, a := range plan {
+		actions[a.Src] = a
+	}
+
+	for id, g := range groups {
+		// The target isn't one of the duplicates so the first of those is the best of them
+		best := 0
+		if target != "" {
+			best = 1
+		}
+		files, _ := dedupe.Describe(g.Files...)
+		group := reportGroup{ID: id}
+		for i, f := range files {
+			rf := reportFile{
+				File:      f,
+				Index:     i,
+				Target:    target != "" && i == 0,
+				Reference: references.Contains(f.Path),
+			}
+			// The best is only kept if the plan leaves it be, like when every file is moved or deleted it isn't
+			a, planned := actions[f.Path]
+			if planned {
+				rf.Action = a.String()
+			}
+			rf.Keep = i == best && (!planned || !a.Op.Destructive())
+			if i != best {
+				rf.Distance = formatDistance(g.Distances[i][best])
+			}
+			rf.Thumbnail, rf.Error = thumbnail(f.Path)
+			group.Files = append(group.Files, rf)
+		}
+		for _, row := range g.Distances {
+			var formatted []string
+			for _, d := range row {
+				formatted = append(formatted, formatDistance(d))
+			}
+			group.Distances = append(group.Distances, formatted)
+		}
+		r.Groups = append(r.Groups, group)
+	}
+
+	f, e := os.Create(path)
+	if e != nil {
+		return e
+	}
+	if e := reportTemplate.Execute(f, r); e != nil {
+		f.Close()
+		return e
+	}
+	return f.Close()
+}
+
+func formatDistance(d float64) string {
+	return strconv.FormatFloat(d, 'f', -1, 64)
+}
+
+// Shrink an image to fit in the thumbnail size and encode it as a data url
+func thumbnail(path string) (template.URL, error) {
+	img, err := utils.LoadImage(path)
+	if err != nil {
+		return "", err
+	}
+	// Resize doesn't keep the aspect ratio for us and small images are left as they are
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if scale := float64(thumbnailSize) / float64(max(width, height)); scale < 1 {
+		width = max(1, int(math.Round(float64(width)*scale)))
+		height = max(1, int(math.Round(float64(height)*scale)))
+	}
+	small := utils.Resize(img, width, height, utils.Linear)
+
+	// JPEG has no transparency so anything see through is shown against white
+	flat := image.NewRGBA(small.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), small, small.Bounds().Min, draw.Over)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: 80}); err != nil {
+		return "", err
+	}
+	// This came from encoding the image ourselves so it's safe to use as a url as is
+	return template.URL(fmt.Sprintf("data:image/jpeg;base64,%s", base64.StdEncoding.EncodeToString(buf.Bytes()))), nil
+}
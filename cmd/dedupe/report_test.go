@@ -0,0 +1,98 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexgQQ/dedupe"
+	"github.com/alexgQQ/dedupe/hash"
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+func writeTestImage(t *testing.T, path string) {
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 150))
+	for x := range 300 {
+		for y := range 150 {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 0, 0xff})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir := t.TempDir()
+	// Paths come from the filesystem so they can't be trusted as html
+	a, b := filepath.Join(dir, "<b>a&b.png"), filepath.Join(dir, "b.png")
+	writeTestImage(t, a)
+	writeTestImage(t, b)
+	groups := []dedupe.Group{{Files: []string{a, b}, Distances: [][]float64{{0, 1}, {1, 0}}}}
+	hashers := []hash.Hasher{hash.DCT}
+
+	report := func(plan utils.Plan) string {
+		path := filepath.Join(dir, "report.html")
+		if err := writeReport(path, hashers, "", groups, nil, plan, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	page := report(utils.PlanDelete([]string{b}))
+	if strings.Contains(page, "<b>a&b.png") || !strings.Contains(page, "&lt;b&gt;a&amp;b.png") {
+		t.Error("Expected the paths to be escaped")
+	}
+	if n := strings.Count(page, `src="data:image/jpeg;base64,`); n != 2 {
+		t.Errorf("Expected a thumbnail embedded for both images but found %d", n)
+	}
+	if n := strings.Count(page, "tag keeper"); n != 1 {
+		t.Errorf("Expected only the first image to be kept but found %d", n)
+	}
+
+	// When the plan deletes every file there is nothing kept
+	page = report(utils.PlanDelete([]string{a, b}))
+	if strings.Contains(page, "tag keeper") {
+		t.Error("Expected nothing to be marked to keep when it's all deleted")
+	}
+}
+
+func TestReportFileExif(t *testing.T) {
+	f := reportFile{File: dedupe.File{Metadata: utils.Metadata{
+		Taken: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Make: "Canon", Model: "EOS 5D",
+	}}}
+	if f.TakenAt() != "2020-01-02 03:04:05" || f.Camera() != "Canon EOS 5D" {
+		t.Errorf("Expected when and on what camera the photo was taken but got %q %q", f.TakenAt(), f.Camera())
+	}
+	if f = (reportFile{}); f.TakenAt() != "" || f.Camera() != "" {
+		t.Error("Expected nothing without EXIF data")
+	}
+}
+
+func TestReportFileBytes(t *testing.T) {
+	for size, want := range map[int64]string{
+		512:           "512.0 B",
+		1536:          "1.5 KB",
+		5 << 20:       "5.0 MB",
+		3 << 40:       "3072.0 GB",
+		(1 << 30) / 2: "512.0 MB",
+	} {
+		if got := (reportFile{File: dedupe.File{Size: size}}).Bytes(); got != want {
+			t.Errorf("Expected %d bytes to be %s but got %s", size, want, got)
+		}
+	}
+}
@@ -4,40 +4,271 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"os"
+	"path/filepath"
 	"runtime"
-	"slices"
 	"sync"
 
+	"github.com/alexgQQ/dedupe/cache"
 	"github.com/alexgQQ/dedupe/hash"
 	"github.com/alexgQQ/dedupe/utils"
 	"github.com/alexgQQ/dedupe/vptree"
 )
 
 var (
-	DHASH hash.HashType = hash.DHASH
-	DCT   hash.HashType = hash.DCT
+	AHASH  hash.Hasher = hash.AHASH
+	DHASH  hash.Hasher = hash.DHASH
+	DCT    hash.Hasher = hash.DCT
+	RADISH hash.Hasher = hash.RADISH
+	WHASH  hash.Hasher = hash.WHASH
 )
 
-func imageHash(hashType hash.HashType, img image.Image) (hashes []uint64) {
-	if hashType.Equal(hash.DCT) {
-		hash := hash.Dct(img)
-		hashes = append(hashes, hash)
-	} else if hashType.Equal(hash.DHASH) {
-		rHash, cHash := hash.Dhash(img)
-		hashes = append(hashes, rHash)
-		hashes = append(hashes, cHash)
+// A Deduper holds the configuration used when searching for duplicates.
+// The package level functions use one with only the hash type set,
+// create one directly to make use of any of the other options.
+type Deduper struct {
+	// Determines the hashing method, this can be any of the ones provided like dedupe.DCT
+	// or anything else that implements hash.Hasher. Use hash.WithThreshold to change the threshold.
+	Hasher hash.Hasher
+	// An optional cache of computed hashes. Files that haven't changed since they were
+	// cached are not decoded again, new or changed files are hashed and added to it.
+	// It is up to the caller to Save the cache afterwards.
+	Cache *cache.Cache
+	// How images within the threshold of each other are grouped together, see GroupMode
+	Grouping GroupMode
+	// Match on several hashers at once instead of just Hasher, each with it's own threshold.
+	// Combine decides how they have to agree for images to be duplicates and Weights are
+	// only used with vptree.Weighted. Indexes and Nearest only work with a single hasher.
+	Hashers []hash.Hasher
+	Combine vptree.Combine
+	Weights []float64
+	// Match images in any orientation, rotated by 90 degrees or mirrored, by hashing each image
+	// in all eight orientations and keeping the smallest distance. Hashing takes eight times as long.
+	// An index built with this keeps every orientation so searching it for duplicates matches them too,
+	// otherwise only the target image is matched in any orientation when querying an index.
+	AnyOrientation bool
+	// Hash the light and dark segments of each image on their own instead of the whole image, which
+	// finds cropped copies. Images are duplicates when at least this many of their segments match,
+	// zero hashes the whole image as usual. This only works with a single hasher.
+	// The Hasher's threshold applies to each segment as is. Segments look alike more easily than
+	// whole images so the cli uses half the hasher's usual threshold, which is a good place to
+	// start with hash.WithThreshold(h, h.Threshold()/2).
+	Segments int
+	// Trim uniform borders like letterboxing or padding from images before hashing them.
+	// TrimTolerance is how far from the border colour a pixel can be and still count as border,
+	// see utils.TrimBorders.
+	TrimBorders   bool
+	TrimTolerance int
+	// Images are rotated or flipped by their EXIF orientation before hashing so photos match
+	// upright copies of them, set this to hash them as they are stored instead
+	IgnoreExifOrientation bool
+	// Sort the files of each group of duplicates so the one most worth keeping is first, see Rank.
+	// Without any the order depends on the grouping.
+	Keep []Ranking
+}
+
+var (
+	errMultiHash = errors.New("only a single hasher is supported for this")
+	errSegments  = errors.New("segment hashing isn't supported for this")
+)
+
+// An image that couldn't be loaded or hashed. These are joined into the error of a search
+// so the rest of the images can still be searched, see LoadErrors to get them back out.
+type LoadError struct {
+	File string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("unable to load %s %v", e.File, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Pull out the images that failed to load from a joined error
+func LoadErrors(err error) (errs []*LoadError) {
+	switch e := err.(type) {
+	case *LoadError:
+		return []*LoadError{e}
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			errs = append(errs, LoadErrors(inner)...)
+		}
 	}
 	return
 }
 
-func buildTree(files []string, hashType hash.HashType) (*vptree.VPTree, *vptree.FileMapper, error) {
+// Check the options work together
+func (d *Deduper) check() error {
+	if d.Segments > 0 && len(d.Hashers) > 0 {
+		return errMultiHash
+	}
+	if len(d.Hashers) > 0 {
+		return vptree.CheckWeights(d.Weights, len(d.Hashers))
+	}
+	return nil
+}
+
+// Indexes and nearest searches need a plain tree of a single hash
+func (d *Deduper) checkSingle() error {
+	if len(d.Hashers) > 0 {
+		return errMultiHash
+	} else if d.Segments > 0 {
+		return errSegments
+	}
+	return nil
+}
+
+// The hashers in use, which is only more than one when matching on several at once
+func (d *Deduper) hashers() []hash.Hasher {
+	if len(d.Hashers) > 0 {
+		return d.Hashers
+	} else if d.Segments > 0 {
+		return []hash.Hasher{hash.Segmented(d.Hasher)}
+	}
+	return []hash.Hasher{d.Hasher}
+}
+
+// The search radius for the tree or forest, a forest scores matches relative to each
+// hasher's threshold so anything under 1 is within all of them
+func (d *Deduper) radius() float64 {
+	if len(d.Hashers) > 0 {
+		return 1
+	}
+	return d.Hasher.Threshold()
+}
+
+// Get the hashes for an image file from each hasher in each orientation in use, indexed by
+// orientation and then hasher. They come from the cache if possible and the image is only
+// loaded if any of them are missing.
+func (d *Deduper) hashFile(file string) ([][][]uint64, error) {
+	hashers := d.hashers()
+	orientations := d.orientations()
+	hashes := make([][][]uint64, len(orientations))
+	for i := range hashes {
+		hashes[i] = make([][]uint64, len(hashers))
+	}
+
+	var info os.FileInfo
+	missing := len(hashers) * len(orientations)
+	if d.Cache != nil {
+		var err error
+		if info, err = os.Stat(file); err != nil {
+			return nil, err
+		}
+		for i, o := range orientations {
+			for j, h := range hashers {
+				if cached, ok := d.Cache.Get(file, d.cacheName(h, o), info); ok {
+					hashes[i][j] = cached
+					missing--
+				}
+			}
+		}
+	}
+	if missing == 0 {
+		return hashes, nil
+	}
+
+	img, err := d.loadImage(file)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range orientations {
+		oriented := img
+		for j, h := range hashers {
+			if hashes[i][j] != nil {
+				continue
+			}
+			if o != utils.OrientNormal && oriented == img {
+				oriented = utils.Orient(img, o)
+			}
+			hashes[i][j] = h.Hash(oriented)
+			if d.Cache != nil {
+				d.Cache.Put(file, d.cacheName(h, o), info, hashes[i][j])
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// Load an image with any preprocessing applied
+func (d *Deduper) loadImage(file string) (image.Image, error) {
+	load := utils.LoadImage
+	if d.IgnoreExifOrientation {
+		load = utils.LoadImageRaw
+	}
+	img, err := load(file)
+	if err != nil {
+		return nil, err
+	}
+	if d.TrimBorders {
+		img = utils.TrimBorders(img, d.TrimTolerance)
+	}
+	return img, nil
+}
+
+// Hashes are cached by hasher name so any preprocessing or other orientations need their own name
+func (d *Deduper) cacheName(h hash.Hasher, orientation int) string {
+	name := h.Name()
+	if d.IgnoreExifOrientation {
+		name += "+raw"
+	}
+	if d.TrimBorders {
+		name = fmt.Sprintf("%s+trim%d", name, d.TrimTolerance)
+	}
+	if orientation != utils.OrientNormal {
+		name = fmt.Sprintf("%s@%d", name, orientation)
+	}
+	return name
+}
+
+// Build a tree of the hashed files, or a forest of them when there are several hashers
+func (d *Deduper) buildSearcher(files []string) (tree searcher, fileMap *vptree.FileMapper, err error) {
+	items, orientations, fileMap, err := d.hashFiles(files)
+	if d.Segments > 0 {
+		tree = vptree.NewRegionTree(items, d.Hasher, d.Segments)
+	} else if len(d.Hashers) == 0 {
+		tree = newSearcher(items, d.Hasher, d.radius())
+	} else {
+		// The weights were already checked so this can't fail
+		tree, _ = vptree.NewForest(items, d.Hashers, d.Weights, d.Combine)
+	}
+	if d.AnyOrientation {
+		tree = &orientedSearcher{searcher: tree, orientations: orientations}
+	}
+	return
+}
+
+// Searching every hash for duplicates of every other is much faster with a MultiIndex when
+// they are compared by their hamming distance, anything else goes in a tree
+func newSearcher(items []*vptree.Item, hasher hash.Hasher, radius float64) searcher {
+	if hash.IsHamming(hasher) {
+		return vptree.NewMultiIndex(items, radius)
+	}
+	return vptree.NewForHasher(items, hasher)
+}
+
+func (d *Deduper) buildTree(files []string) (*vptree.VPTree, *vptree.FileMapper, error) {
+	items, _, fileMap, err := d.hashFiles(files)
+	return vptree.NewForHasher(items, d.Hasher), fileMap, err
+}
+
+// Hash the files into items for a tree. When matching any orientation the items for every
+// orientation of each file are returned too, indexed by ID.
+func (d *Deduper) hashFiles(files []string) ([]*vptree.Item, [][]vptree.Item, *vptree.FileMapper, error) {
 	var wg sync.WaitGroup
 	var fileMap vptree.FileMapper
 
 	// By default this will be the runtime.NumCPU but will be GOMAXPROCS if set in the environment
 	nProcs := runtime.GOMAXPROCS(0)
 	work := make(chan string)
-	results := make(chan *vptree.Item)
+	type hashed struct {
+		item         *vptree.Item
+		orientations []vptree.Item
+	}
+	results := make(chan hashed)
 	// If any images fail to load I want to be able to track that but this adds some complexity
 	// since it is across routines. The main process will process the results channel while they come in
 	// but if errors occur that would cause deadlock in whatever routine errored. This can be alleviated by
@@ -47,20 +278,28 @@ func buildTree(files []string, hashType hash.HashType) (*vptree.VPTree, *vptree.
 	errs := make(chan error)
 
 	// Spin up workers to process images concurrently but leave two for handling and error accumulation
-	for range nProcs - 2 {
+	// if we can, with only one or two procs available that would leave no workers at all
+	for range max(1, nProcs-2) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for f := range work {
-				img, err := utils.LoadImage(f)
+				hashes, err := d.hashFile(f)
 				if err != nil {
-					errs <- fmt.Errorf("unable to load %s %w", f, err)
+					errs <- &LoadError{File: f, Err: err}
 					continue
 				}
 				var item *vptree.Item
-				hashes := imageHash(hashType, img)
-				item = vptree.NewItem(f, &fileMap, hashes...)
-				results <- item
+				if len(d.Hashers) > 0 {
+					item = vptree.NewMultiItem(f, &fileMap, hashes[0])
+				} else {
+					item = vptree.NewItem(f, &fileMap, hashes[0][0]...)
+				}
+				var orientations []vptree.Item
+				if d.AnyOrientation {
+					orientations = d.orientedItems(item.ID, hashes)
+				}
+				results <- hashed{item, orientations}
 			}
 		}()
 	}
@@ -78,69 +317,265 @@ func buildTree(files []string, hashType hash.HashType) (*vptree.VPTree, *vptree.
 
 	// Accumulate errors on a separate routine to avoid blocking the channel
 	var err error
+	errDone := make(chan struct{})
 	go func() {
 		for e := range errs {
 			err = errors.Join(err, e)
 		}
+		close(errDone)
 	}()
 
 	// Accumulate the computed hashes to build the vptree
 	var items []*vptree.Item
-	for item := range results {
-		if item == nil {
-			continue
+	var oriented []hashed
+	for r := range results {
+		items = append(items, r.item)
+		if d.AnyOrientation {
+			oriented = append(oriented, r)
+		}
+	}
+	<-errDone
+
+	var orientations [][]vptree.Item
+	if d.AnyOrientation {
+		orientations = make([][]vptree.Item, fileMap.Len()+1)
+		for _, r := range oriented {
+			orientations[r.item.ID] = r.orientations
 		}
-		items = append(items, item)
 	}
+	return items, orientations, &fileMap, err
+}
 
-	return vptree.New(items), &fileMap, err
+// Find any files in the tree within the threshold of any of the targets,
+// which are the target image in each orientation in use
+func compareHashes(tree searcher, fileMap *vptree.FileMapper, targets []vptree.Item, threshold float64) (filenames []string) {
+	results, _ := withinAny(tree, targets, threshold)
+	if len(results) <= 0 {
+		return
+	}
+	filenames = make([]string, len(results))
+	for i, r := range results {
+		filenames[i] = fileMap.ByID(r.ID)
+	}
+	return
 }
 
 // Find groups of duplicate images from a list of given images
-// hashTypes determines the hashing method and can be either dedupe.DCT or dedupe.DHASH
-func Duplicates(hashType hash.HashType, files []string) (duplicates [][]string, total int, err error) {
-	var skip []uint
-	tree, fileMap, err := buildTree(files, hashType)
-	for item := range tree.All() {
-		if slices.Contains(skip, item.ID) {
-			continue
-		}
-		found, _ := tree.Within(item, hashType.Threshold)
-		if len(found) <= 0 {
-			continue
-		}
-		group := make([]string, len(found)+1)
-		skip = append(skip, item.ID)
-		group[0] = fileMap.ByID(item.ID)
-		for i, item := range found {
-			group[i+1] = fileMap.ByID(item.ID)
-			skip = append(skip, item.ID)
-		}
-		total += len(group)
-		duplicates = append(duplicates, group)
+// hasher determines the hashing method, like dedupe.DCT or any other hash.Hasher
+func Duplicates(hasher hash.Hasher, files []string) (duplicates [][]string, total int, err error) {
+	d := Deduper{Hasher: hasher}
+	return d.Duplicates(files)
+}
+
+// Find groups of duplicate images from a list of given images
+func (d *Deduper) Duplicates(files []string) (duplicates [][]string, total int, err error) {
+	duplicates, total, _, err = d.duplicates(files)
+	return
+}
+
+func (d *Deduper) duplicates(files []string) (duplicates [][]string, total int, distances distanceFunc, err error) {
+	if err = d.check(); err != nil {
+		return
+	}
+	tree, fileMap, err := d.buildSearcher(files)
+	duplicates, total = groupDuplicates(tree, fileMap, d.radius(), d.Grouping)
+	if len(d.Keep) > 0 {
+		err = errors.Join(err, RankGroups(duplicates, d.Keep...))
 	}
+	distances = pairDistances(tree, fileMap, nil)
 	return
 }
 
 // Find any duplicate images of the target image from given image files
-// hashTypes determines the hashing method and can be either dedupe.DCT or dedupe.DHASH
-func Compare(hashType hash.HashType, target string, files ...string) (filenames []string, err error) {
+// hasher determines the hashing method, like dedupe.DCT or any other hash.Hasher
+func Compare(hasher hash.Hasher, target string, files ...string) (filenames []string, err error) {
+	d := Deduper{Hasher: hasher}
+	return d.Compare(target, files...)
+}
+
+// Find any duplicate images of the target image from given image files
+func (d *Deduper) Compare(target string, files ...string) (filenames []string, err error) {
+	filenames, _, err = d.compare(target, files...)
+	return
+}
+
+func (d *Deduper) compare(target string, files ...string) (filenames []string, distances distanceFunc, err error) {
 	// It should be noted that for a few amount of files building the tree might be overkill
 	// but I'd rather have it consistent
-	img, err := utils.LoadImage(target)
+	if err = d.check(); err != nil {
+		return
+	}
+	hashes, err := d.hashFile(target)
 	if err != nil {
+		err = &LoadError{File: target, Err: err}
 		return
 	}
-	tree, fileMap, err := buildTree(files, hashType)
-	hashes := imageHash(hashType, img)
-	item := vptree.NewItem(target, fileMap, hashes...)
-	results, _ := tree.Within(*item, hashType.Threshold)
-	if len(results) <= 0 {
+	tree, fileMap, err := d.buildSearcher(files)
+	// IDs are 1-indexed so a zero ID will never be excluded as the target itself
+	targets := d.orientedItems(0, hashes)
+	filenames = compareHashes(tree, fileMap, targets, d.radius())
+	if len(d.Keep) > 0 && len(filenames) > 0 {
+		err = errors.Join(err, RankGroups([][]string{filenames}, d.Keep...))
+	}
+	distances = pairDistances(tree, fileMap, map[string][]vptree.Item{target: targets})
+	return
+}
+
+// Find the k most similar images to the target from given image files regardless of the threshold.
+// The results are sorted from most to least similar along with their distance from the target.
+// The target is never one of the results, even when it's one of the files.
+// hasher determines the hashing method, like dedupe.DCT or any other hash.Hasher
+func Nearest(hasher hash.Hasher, target string, k int, files ...string) (filenames []string, distances []float64, err error) {
+	d := Deduper{Hasher: hasher}
+	return d.Nearest(target, k, files...)
+}
+
+// Find the k most similar images to the target from given image files regardless of the threshold.
+// The results are sorted from most to least similar along with their distance from the target.
+// The target is never one of the results, even when it's one of the files.
+func (d *Deduper) Nearest(target string, k int, files ...string) (filenames []string, distances []float64, err error) {
+	if err = d.checkSingle(); err != nil {
 		return
 	}
-	filenames = make([]string, len(results))
+	hashes, err := d.hashFile(target)
+	if err != nil {
+		err = &LoadError{File: target, Err: err}
+		return
+	}
+	tree, fileMap, err := d.buildTree(files)
+	filenames, distances = nearestHashes(tree, fileMap, target, d.orientedItems(0, hashes), k)
+	return
+}
+
+// The target is hashed on it's own so if it's one of the searched files too it would be it's own
+// nearest image, one more is searched for in case it has to be left out
+func nearestHashes(tree *vptree.VPTree, fileMap *vptree.FileMapper, target string, targets []vptree.Item, k int) (filenames []string, distances []float64) {
+	results, found := searchAny(tree, targets, k+1)
+	self := absPath(target)
 	for i, r := range results {
-		filenames[i] = fileMap.ByID(r.ID)
+		file := fileMap.ByID(r.ID)
+		if len(filenames) == k || absPath(file) == self {
+			continue
+		}
+		filenames = append(filenames, file)
+		distances = append(distances, found[i])
+	}
+	return
+}
+
+// The cleaned absolute path of a file so the same file given two ways can be compared
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return filepath.Clean(file)
+}
+
+// Hash the given images into an index that can be saved and queried later on.
+// Any images that fail to load are left out of the index and reported in the error.
+func (d *Deduper) BuildIndex(files []string) (*vptree.Index, error) {
+	if err := d.checkSingle(); err != nil {
+		return nil, err
+	}
+	items, orientations, fileMap, err := d.hashFiles(files)
+	idx := &vptree.Index{
+		Tree:   vptree.NewForHasher(items, d.Hasher),
+		Files:  fileMap,
+		Hasher: d.Hasher,
+		Options: vptree.IndexOptions{
+			TrimBorders:           d.TrimBorders,
+			TrimTolerance:         d.TrimTolerance,
+			IgnoreExifOrientation: d.IgnoreExifOrientation,
+			AnyOrientation:        d.AnyOrientation,
+		},
+		Orientations: orientations,
+	}
+	return idx, err
+}
+
+// Find groups of duplicate images within a prebuilt index.
+// The hasher and threshold of the index are used instead of the Deduper's.
+func (d *Deduper) DuplicatesIndex(idx *vptree.Index) (duplicates [][]string, total int) {
+	duplicates, total, _ = d.duplicatesIndex(idx)
+	return
+}
+
+func (d *Deduper) duplicatesIndex(idx *vptree.Index) (duplicates [][]string, total int, distances distanceFunc) {
+	tree := indexSearcher(idx)
+	duplicates, total = groupDuplicates(tree, idx.Files, idx.Hasher.Threshold(), d.Grouping)
+	distances = pairDistances(tree, idx.Files, nil)
+	return
+}
+
+// The tree of an index is what's saved but it's items can be searched faster, see newSearcher.
+// Indexes built to match any orientation match each of their images in any orientation too.
+func indexSearcher(idx *vptree.Index) (tree searcher) {
+	tree = idx.Tree
+	if hash.IsHamming(idx.Hasher) {
+		var items []*vptree.Item
+		for item := range idx.Tree.All() {
+			items = append(items, &item)
+		}
+		tree = vptree.NewMultiIndex(items, idx.Hasher.Threshold())
+	}
+	if idx.Orientations != nil {
+		tree = &orientedSearcher{searcher: tree, orientations: idx.Orientations}
+	}
+	return
+}
+
+// A copy of the Deduper that hashes images the same way the index was built
+func (d *Deduper) forIndex(idx *vptree.Index) (*Deduper, error) {
+	if idx.Options.Segments > 0 {
+		return nil, errSegments
+	}
+	indexed := *d
+	indexed.Hasher = idx.Hasher
+	indexed.Hashers = nil
+	indexed.Segments = 0
+	indexed.TrimBorders = idx.Options.TrimBorders
+	indexed.TrimTolerance = idx.Options.TrimTolerance
+	indexed.IgnoreExifOrientation = idx.Options.IgnoreExifOrientation
+	// Each image of the index matches in any orientation so the target should too
+	indexed.AnyOrientation = d.AnyOrientation || idx.Options.AnyOrientation
+	return &indexed, nil
+}
+
+// Find any duplicate images of the target image within a prebuilt index.
+// The hasher, threshold and loading options of the index are used instead of the Deduper's.
+func (d *Deduper) CompareIndex(idx *vptree.Index, target string) (filenames []string, err error) {
+	filenames, _, err = d.compareIndex(idx, target)
+	return
+}
+
+func (d *Deduper) compareIndex(idx *vptree.Index, target string) (filenames []string, distances distanceFunc, err error) {
+	indexed, err := d.forIndex(idx)
+	if err != nil {
+		return
+	}
+	hashes, err := indexed.hashFile(target)
+	if err != nil {
+		err = &LoadError{File: target, Err: err}
+		return
+	}
+	targets := indexed.orientedItems(0, hashes)
+	filenames = compareHashes(idx.Tree, idx.Files, targets, idx.Hasher.Threshold())
+	distances = pairDistances(idx.Tree, idx.Files, map[string][]vptree.Item{target: targets})
+	return
+}
+
+// Find the k most similar images to the target within a prebuilt index, leaving out the target.
+// The hasher and loading options of the index are used instead of the Deduper's.
+func (d *Deduper) NearestIndex(idx *vptree.Index, target string, k int) (filenames []string, distances []float64, err error) {
+	indexed, err := d.forIndex(idx)
+	if err != nil {
+		return
+	}
+	hashes, err := indexed.hashFile(target)
+	if err != nil {
+		err = &LoadError{File: target, Err: err}
+		return
 	}
+	filenames, distances = nearestHashes(idx.Tree, idx.Files, target, indexed.orientedItems(0, hashes), k)
 	return
 }
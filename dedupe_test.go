@@ -0,0 +1,68 @@
+package dedupe
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// Write a copy of the cat test image changed by each of the transforms into a temporary
+// directory, in the same order as the transforms
+func writeCats(t *testing.T, transforms ...func(img image.Image) image.Image) (paths []string) {
+	t.Helper()
+	img, err := utils.LoadImage("testimages/cats/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for i, transform := range transforms {
+		path := filepath.Join(dir, fmt.Sprintf("cat%d.png", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, transform(img))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return
+}
+
+func TestNearestWithoutTarget(t *testing.T) {
+	files := utils.FindImages("testimages/cats", false)
+	// The same file given another way is still the target
+	target := "./testimages/cats/../cats/cat.jpg"
+	if !slices.Contains(files, "testimages/cats/cat.jpg") {
+		t.Fatalf("Expected the target to be one of the searched files %v", files)
+	}
+
+	d := Deduper{Hasher: DCT}
+	found, distances, err := d.Nearest(target, 3, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || len(distances) != 3 || slices.Contains(found, "testimages/cats/cat.jpg") {
+		t.Errorf("Expected the 3 nearest images without the target but found %v", found)
+	}
+
+	idx, err := d.BuildIndex(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, _, err := d.NearestIndex(idx, target, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 3 || slices.Contains(indexed, "testimages/cats/cat.jpg") {
+		t.Errorf("Expected the 3 nearest images in the index without the target but found %v", indexed)
+	}
+}
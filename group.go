@@ -0,0 +1,259 @@
+package dedupe
+
+import (
+	"cmp"
+	"iter"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alexgQQ/dedupe/vptree"
+)
+
+// How images are grouped together once we know which ones are within the threshold of each other
+type GroupMode int
+
+const (
+	// Each image is grouped with anything within the threshold of it and any image already
+	// grouped is skipped. This is quick but the groups depend on the order the tree is walked,
+	// which is random, so a chain of matches can be split or merged differently between runs.
+	Greedy GroupMode = iota
+	// Images are grouped by chains of matches, if A matches B and B matches C then all three are
+	// one group even if A and C don't match. The groups are the same regardless of traversal order.
+	Connected
+	// Every image in a group is within the threshold of every other image in the group.
+	// Images are considered in path order so the groups are the same between runs.
+	Strict
+)
+
+var GroupModes = map[string]GroupMode{
+	"greedy":    Greedy,
+	"connected": Connected,
+	"strict":    Strict,
+}
+
+// Either a single tree or a forest of them, grouping only needs to walk every item and find it's neighbours
+type searcher interface {
+	All() iter.Seq[vptree.Item]
+	Within(target vptree.Item, radius float64) ([]vptree.Item, []float64)
+	Distance(a, b vptree.Item) float64
+}
+
+// Group the items in the tree that are within the threshold of each other
+func groupDuplicates(tree searcher, fileMap *vptree.FileMapper, threshold float64, mode GroupMode) (duplicates [][]string, total int) {
+	graph := neighbourGraph(tree, fileMap.Len(), threshold)
+	duplicates = groupGraph(tree, graph, fileMap, mode)
+	for _, group := range duplicates {
+		total += len(group)
+	}
+	return
+}
+
+func groupGraph(tree searcher, graph [][]uint, fileMap *vptree.FileMapper, mode GroupMode) [][]string {
+	switch mode {
+	case Connected:
+		return connectedGroups(graph, fileMap)
+	case Strict:
+		return strictGroups(graph, fileMap)
+	default:
+		return greedyGroups(tree, graph, fileMap)
+	}
+}
+
+// Find the IDs within the threshold of every item in the tree. The result is indexed by ID
+// so the first slot is always empty, and each list of neighbours is sorted.
+// Every item needs it's own query which is where most of the time goes for large sets,
+// but the queries only read from the tree so they are split across workers.
+func neighbourGraph(tree searcher, size int, threshold float64) [][]uint {
+	items := make([]vptree.Item, 0, size)
+	for item := range tree.All() {
+		items = append(items, item)
+	}
+
+	// Each item has a unique ID so workers never write to the same slot
+	graph := make([][]uint, size+1)
+	var wg sync.WaitGroup
+	var next atomic.Int64
+	// Hand out work in batches rather than one at a time to keep contention on the counter low
+	batch := int64(256)
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				start := next.Add(batch) - batch
+				if start >= int64(len(items)) {
+					return
+				}
+				end := min(start+batch, int64(len(items)))
+				for _, item := range items[start:end] {
+					found, _ := tree.Within(item, threshold)
+					if len(found) == 0 {
+						continue
+					}
+					ids := make([]uint, len(found))
+					for i, f := range found {
+						ids[i] = f.ID
+					}
+					slices.Sort(ids)
+					graph[item.ID] = ids
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return graph
+}
+
+// Group every item in the tree with any others within the threshold of it, skipping
+// any items that were already grouped. Tree order is kept here for consistency with
+// how this has always worked even though the Connected mode is more predictable.
+func greedyGroups(tree searcher, graph [][]uint, fileMap *vptree.FileMapper) (duplicates [][]string) {
+	// The IDs are dense and 1-indexed so a flat slice works as the visited set
+	visited := make([]bool, len(graph))
+	for item := range tree.All() {
+		if visited[item.ID] {
+			continue
+		}
+		found := graph[item.ID]
+		if len(found) <= 0 {
+			continue
+		}
+		group := make([]string, len(found)+1)
+		visited[item.ID] = true
+		group[0] = fileMap.ByID(item.ID)
+		for i, id := range found {
+			group[i+1] = fileMap.ByID(id)
+			visited[id] = true
+		}
+		duplicates = append(duplicates, group)
+	}
+	return
+}
+
+type unionFind struct {
+	parent []uint
+	rank   []uint8
+}
+
+func newUnionFind(size int) *unionFind {
+	u := &unionFind{parent: make([]uint, size), rank: make([]uint8, size)}
+	for i := range u.parent {
+		u.parent[i] = uint(i)
+	}
+	return u
+}
+
+func (u *unionFind) find(x uint) uint {
+	for u.parent[x] != x {
+		// Path halving keeps the trees shallow without needing recursion
+		u.parent[x] = u.parent[u.parent[x]]
+		x = u.parent[x]
+	}
+	return x
+}
+
+func (u *unionFind) union(a, b uint) {
+	a, b = u.find(a), u.find(b)
+	if a == b {
+		return
+	}
+	if u.rank[a] < u.rank[b] {
+		a, b = b, a
+	}
+	u.parent[b] = a
+	if u.rank[a] == u.rank[b] {
+		u.rank[a]++
+	}
+}
+
+// Order group members by path and then the groups by their first member
+// so results are stable between runs
+func sortGroups(groups [][]string) {
+	for _, g := range groups {
+		slices.Sort(g)
+	}
+	slices.SortFunc(groups, func(a, b []string) int {
+		return cmp.Compare(a[0], b[0])
+	})
+}
+
+func connectedGroups(graph [][]uint, fileMap *vptree.FileMapper) (duplicates [][]string) {
+	u := newUnionFind(len(graph))
+	for id, neighbours := range graph {
+		for _, n := range neighbours {
+			u.union(uint(id), n)
+		}
+	}
+
+	components := make(map[uint][]string)
+	for id := 1; id < len(graph); id++ {
+		if len(graph[id]) == 0 {
+			continue
+		}
+		root := u.find(uint(id))
+		components[root] = append(components[root], fileMap.ByID(uint(id)))
+	}
+	for _, group := range components {
+		duplicates = append(duplicates, group)
+	}
+	sortGroups(duplicates)
+	return
+}
+
+func strictGroups(graph [][]uint, fileMap *vptree.FileMapper) (duplicates [][]string) {
+	byPath := func(a, b uint) int {
+		return cmp.Compare(fileMap.ByID(a), fileMap.ByID(b))
+	}
+	adjacent := func(a, b uint) bool {
+		_, found := slices.BinarySearch(graph[a], b)
+		return found
+	}
+
+	ids := make([]uint, 0, len(graph))
+	for id := 1; id < len(graph); id++ {
+		if len(graph[id]) > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	slices.SortFunc(ids, byPath)
+
+	// Each group starts from the first ungrouped image and takes any of it's ungrouped
+	// neighbours, in path order, that match everything already in the group
+	grouped := make([]bool, len(graph))
+	for _, id := range ids {
+		if grouped[id] {
+			continue
+		}
+		candidates := slices.Clone(graph[id])
+		slices.SortFunc(candidates, byPath)
+		members := []uint{id}
+		for _, c := range candidates {
+			if grouped[c] {
+				continue
+			}
+			matchesAll := true
+			for _, m := range members[1:] {
+				if !adjacent(c, m) {
+					matchesAll = false
+					break
+				}
+			}
+			if matchesAll {
+				members = append(members, c)
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		group := make([]string, len(members))
+		for i, m := range members {
+			grouped[m] = true
+			group[i] = fileMap.ByID(m)
+		}
+		duplicates = append(duplicates, group)
+	}
+	sortGroups(duplicates)
+	return
+}
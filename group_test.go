@@ -0,0 +1,120 @@
+package dedupe
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/vptree"
+)
+
+// A chain where a matches b and b matches c but a and c don't match,
+// along with a separate pair d and e and a lone image f
+func chainGraph() ([][]uint, *vptree.FileMapper) {
+	var fileMap vptree.FileMapper
+	for _, name := range []string{"c.jpg", "a.jpg", "e.jpg", "b.jpg", "f.jpg", "d.jpg"} {
+		vptree.NewItem(name, &fileMap)
+	}
+	// IDs follow the insertion order above: c=1 a=2 e=3 b=4 f=5 d=6
+	graph := [][]uint{
+		nil,
+		{4},    // c -> b
+		{4},    // a -> b
+		{6},    // e -> d
+		{1, 2}, // b -> c, a
+		nil,    // f
+		{3},    // d -> e
+	}
+	return graph, &fileMap
+}
+
+func TestConnectedGroups(t *testing.T) {
+	graph, fileMap := chainGraph()
+	groups := connectedGroups(graph, fileMap)
+	expected := [][]string{{"a.jpg", "b.jpg", "c.jpg"}, {"d.jpg", "e.jpg"}}
+	if !slices.EqualFunc(groups, expected, slices.Equal) {
+		t.Errorf("Connected groups were %v but expected %v", groups, expected)
+	}
+}
+
+func TestStrictGroups(t *testing.T) {
+	graph, fileMap := chainGraph()
+	groups := strictGroups(graph, fileMap)
+	// a is first by path and takes b, which leaves c without anything to match
+	expected := [][]string{{"a.jpg", "b.jpg"}, {"d.jpg", "e.jpg"}}
+	if !slices.EqualFunc(groups, expected, slices.Equal) {
+		t.Errorf("Strict groups were %v but expected %v", groups, expected)
+	}
+}
+
+func TestGroupModesAgree(t *testing.T) {
+	// Without any chains every mode should find the same groups
+	var fileMap vptree.FileMapper
+	var items []*vptree.Item
+	for i := range 10 {
+		// Pairs of items that differ by a single bit and are far from every other pair
+		base := uint64(0xff) << (i / 2 * 8)
+		items = append(items, vptree.NewItem(fmt.Sprintf("%d.jpg", i), &fileMap, base^uint64(i%2)))
+	}
+	tree := vptree.New(items)
+
+	var results [][][]string
+	for _, mode := range []GroupMode{Greedy, Connected, Strict} {
+		groups, total := groupDuplicates(tree, &fileMap, 3, mode)
+		if total != 10 {
+			t.Errorf("Mode %d grouped %d images but expected 10", mode, total)
+		}
+		sortGroups(groups)
+		results = append(results, groups)
+	}
+	for _, groups := range results[1:] {
+		if !slices.EqualFunc(groups, results[0], slices.Equal) {
+			t.Errorf("Groups %v differ from %v", groups, results[0])
+		}
+	}
+}
+
+// Build a set of hashes the way a real library tends to look, where there are a few near copies
+// of each distinct image a few bits away from it's original. The distinct images get a copy
+// each on average so the neighbour graph stays a realistic size, with a few thousand centres
+// for a million images it would be billions of pairs.
+func clusteredItems(size int) ([]*vptree.Item, *vptree.FileMapper) {
+	r := rand.New(rand.NewPCG(3, 4))
+	bases := make([]uint64, max(1, size/2))
+	for i := range bases {
+		bases[i] = r.Uint64()
+	}
+	var fileMap vptree.FileMapper
+	items := make([]*vptree.Item, size)
+	for i := range items {
+		h := bases[r.IntN(len(bases))]
+		for range r.IntN(4) {
+			h ^= 1 << r.IntN(64)
+		}
+		items[i] = vptree.NewItem(fmt.Sprintf("%d.jpg", i), &fileMap, h)
+	}
+	return items, &fileMap
+}
+
+// Everything from the neighbour queries to the groups, this is what searching a library for
+// duplicates costs once it's hashed. A tree can't prune much between distinct 64 bit hashes so
+// it's queries grow close to quadratically and it's only run on the smallest size to compare.
+func BenchmarkGroupDuplicates(b *testing.B) {
+	for _, size := range []int{10_000, 100_000} {
+		items, fileMap := clusteredItems(size)
+		b.Run(fmt.Sprintf("multiindex/%d", size), func(b *testing.B) {
+			for range b.N {
+				groupDuplicates(vptree.NewMultiIndex(items, 10), fileMap, 10, Greedy)
+			}
+		})
+		if size <= 10_000 {
+			b.Run(fmt.Sprintf("vptree/%d", size), func(b *testing.B) {
+				tree := vptree.New(items)
+				for range b.N {
+					groupDuplicates(tree, fileMap, 10, Greedy)
+				}
+			})
+		}
+	}
+}
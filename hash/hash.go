@@ -10,39 +10,6 @@ import (
 	"github.com/alexgQQ/dedupe/utils"
 )
 
-type HashType struct {
-	name      string
-	Threshold float64
-}
-
-// Since the HashType is a struct any comparison done in a switch
-// statement will compare all fields,
-// so if the Threshold is changed via flags then it fails downstream
-func (h HashType) Equal(H HashType) bool {
-	return h.name == H.name
-}
-
-// Based on some of the initial documentation,
-// https://www.hackerfactor.com/blog/index.php?/archives/529-Kind-of-Like-That.html
-// https://phash.org/docs/design.html
-// The dhash implementation should work with 10 and the dct should work with 22
-var DHASH HashType = HashType{
-	name:      "dhash",
-	Threshold: 10.0,
-}
-
-// I did some tests on other large image sets and found that non-duplicates did fall within 18-20
-// Maybe some more testing should be done or just lower this/make it configurable by call
-var DCT HashType = HashType{
-	name:      "dct",
-	Threshold: 22.0,
-}
-
-var HashTypes = map[string]HashType{
-	DHASH.name: DHASH,
-	DCT.name:   DCT,
-}
-
 // Convert to greyscale with the luminosity approximation
 func colorToGrey(c color.Color) float64 {
 	r, g, b, _ := c.RGBA()
@@ -77,6 +44,31 @@ func Dhash(img image.Image) (row, col uint64) {
 	return
 }
 
+// The average hash is described alongside the dhash here https://www.hackerfactor.com/blog/index.php?/archives/432-Looks-Like-It.html
+// The image is shrunk down to 8x8 and each bit is set if that pixel is brighter than the mean
+func Ahash(img image.Image) (hash uint64) {
+	size := 8
+	img = utils.Resize(img, size, size, utils.Linear)
+
+	grey := make([]float64, size*size)
+	var mean float64
+	for x := range size {
+		for y := range size {
+			v := colorToGrey(img.At(x, y))
+			grey[size*y+x] = v
+			mean += v
+		}
+	}
+	mean /= float64(size * size)
+
+	for n, v := range grey {
+		if v > mean {
+			hash |= 1 << n
+		}
+	}
+	return
+}
+
 // This is ported from https://github.com/azr/phash/blob/main/dtc.go
 func Dct(img image.Image) (phash uint64) {
 	// For image resizing we really don't need a high quality process and can likely ignore samplers that optimize for upscaling
@@ -157,3 +149,15 @@ func Dct(img image.Image) (phash uint64) {
 func Hamming(a, b uint64) int {
 	return bits.OnesCount64(a ^ b)
 }
+
+// The total hamming distance across multi part hashes like the dhash
+func HammingDistance(a, b []uint64) float64 {
+	if len(a) != len(b) {
+		panic("The hash sizes must be the same")
+	}
+	var dist int
+	for i, h := range a {
+		dist += Hamming(h, b[i])
+	}
+	return float64(dist)
+}
@@ -4,7 +4,10 @@ import (
 	"image"
 	"image/color"
 	"math"
+	"path/filepath"
 	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
 )
 
 // These tests are specific in validating the Hamming function can fulfill the
@@ -77,3 +80,36 @@ func TestZeroDhash(t *testing.T) {
 		t.Error("The column hash for a uniform white image should be zero")
 	}
 }
+
+func TestZeroAhash(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := range 100 {
+		for x := range 100 {
+			img.Set(x, y, color.White)
+		}
+	}
+	if Ahash(img) != 0 {
+		t.Error("The average hash for a uniform white image should be zero")
+	}
+}
+
+func TestAhashCats(t *testing.T) {
+	load := func(name string) uint64 {
+		img, err := utils.LoadImage(filepath.Join("..", "testimages", "cats", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Ahash(img)
+	}
+	cat := load("cat.jpg")
+	for _, name := range []string{"cat-dark.jpg", "cat-distorted.jpg", "cat-shrink.jpg", "cat-upscaled.jpg"} {
+		if dist := Hamming(cat, load(name)); float64(dist) >= AHASH.Threshold() {
+			t.Errorf("%s should be a duplicate of cat.jpg but has a distance of %d", name, dist)
+		}
+	}
+	for _, name := range []string{"cat-on-couch.jpg", "kitten.jpg", "kitten-looking-up.jpg"} {
+		if dist := Hamming(cat, load(name)); float64(dist) < AHASH.Threshold() {
+			t.Errorf("%s should not be a duplicate of cat.jpg but has a distance of %d", name, dist)
+		}
+	}
+}
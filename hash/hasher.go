@@ -0,0 +1,191 @@
+package hash
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+)
+
+// A Hasher is a method of perceptual hashing. Any hasher that is registered can be used
+// through dedupe and the cli by it's name, so hashes from other packages work the same
+// as the ones here.
+type Hasher interface {
+	// A unique name for the hash, this is how it is picked from the cli and is used as the
+	// key for any cached or indexed hashes so it shouldn't change once in use
+	Name() string
+	// Compute the hash of an image. This can be any number of 64 bit values
+	// but should always be the same length for the same hasher.
+	Hash(img image.Image) []uint64
+	// How far apart two hashes are, zero for the same hash and larger is less similar.
+	// For the best results this should be a true metric, see vptree.Metric
+	Distance(a, b []uint64) float64
+	// Images with a distance under this are considered duplicates by default
+	Threshold() float64
+}
+
+// A Hasher can implement this to say it's distance isn't a true metric. Anything searching
+// those hashes has to compare against every one of them since a tree can't be trusted to prune.
+type NonMetric interface {
+	Hasher
+	NonMetric() bool
+}
+
+// Whether the hasher's distance is a true metric that a tree can prune with, see NonMetric
+func IsMetric(h Hasher) bool {
+	n, ok := h.(NonMetric)
+	return !ok || !n.NonMetric()
+}
+
+// A Hasher can implement this to say it's distance is the hamming distance across all of
+// it's bits, which can be searched much faster than an arbitrary metric
+type HammingHasher interface {
+	Hasher
+	Hamming() bool
+}
+
+// Whether the hasher's distance is the hamming distance, see HammingHasher
+func IsHamming(h Hasher) bool {
+	n, ok := h.(HammingHasher)
+	return ok && n.Hamming()
+}
+
+type hasher struct {
+	name      string
+	threshold float64
+	hash      func(img image.Image) []uint64
+	distance  func(a, b []uint64) float64
+	nonMetric bool
+	hamming   bool
+}
+
+func (h *hasher) Name() string                   { return h.name }
+func (h *hasher) Hash(img image.Image) []uint64  { return h.hash(img) }
+func (h *hasher) Distance(a, b []uint64) float64 { return h.distance(a, b) }
+func (h *hasher) Threshold() float64             { return h.threshold }
+func (h *hasher) NonMetric() bool                { return h.nonMetric }
+func (h *hasher) Hamming() bool                  { return h.hamming }
+
+// Create a Hasher from a hash function. The distance can be left nil to compare hashes by their
+// hamming distance which is what most perceptual hashes use.
+func New(name string, threshold float64, hash func(img image.Image) []uint64, distance func(a, b []uint64) float64) Hasher {
+	hamming := distance == nil
+	if hamming {
+		distance = HammingDistance
+	}
+	return &hasher{name: name, threshold: threshold, hash: hash, distance: distance, hamming: hamming}
+}
+
+// Create a Hasher like New for a distance that doesn't hold to the triangle inequality
+func NewNonMetric(name string, threshold float64, hash func(img image.Image) []uint64, distance func(a, b []uint64) float64) Hasher {
+	h := New(name, threshold, hash, distance).(*hasher)
+	h.nonMetric = true
+	return h
+}
+
+type withThreshold struct {
+	Hasher
+	threshold float64
+}
+
+func (h withThreshold) Threshold() float64 { return h.threshold }
+func (h withThreshold) NonMetric() bool    { return !IsMetric(h.Hasher) }
+func (h withThreshold) Hamming() bool      { return IsHamming(h.Hasher) }
+
+// Use a hasher with a different threshold, like one provided by flags
+func WithThreshold(h Hasher, threshold float64) Hasher {
+	if w, ok := h.(withThreshold); ok {
+		h = w.Hasher
+	}
+	return withThreshold{Hasher: h, threshold: threshold}
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Hasher)
+)
+
+// Make a hasher available by it's name. Like database/sql drivers this is meant
+// to be called from an init function and panics if the name is already taken.
+func Register(h Hasher) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if h == nil {
+		panic("hash: Register hasher is nil")
+	}
+	name := h.Name()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("hash: Register called twice for %s", name))
+	}
+	registry[name] = h
+}
+
+// Only for tests to clean up after themselves
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, name)
+}
+
+// Find a registered hasher by name
+func Lookup(name string) (Hasher, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	h, ok := registry[name]
+	return h, ok
+}
+
+// The names of all registered hashers in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Based on some of the initial documentation,
+// https://www.hackerfactor.com/blog/index.php?/archives/529-Kind-of-Like-That.html
+// https://phash.org/docs/design.html
+// The dhash implementation should work with 10 and the dct should work with 22
+var DHASH Hasher = New("dhash", 10.0, func(img image.Image) []uint64 {
+	row, col := Dhash(img)
+	return []uint64{row, col}
+}, nil)
+
+// I did some tests on other large image sets and found that non-duplicates did fall within 18-20
+// Maybe some more testing should be done or just lower this/make it configurable by call
+var DCT Hasher = New("dct", 22.0, func(img image.Image) []uint64 {
+	return []uint64{Dct(img)}
+}, nil)
+
+// The average hash is the least discriminating of the bunch but very cheap to compute.
+// Against the cat images resized, darkened and distorted copies fall within 6 and other cats
+// are 25 and up, but the saturated and skewed copies drift out to 15-17. Letting those in
+// starts chaining unrelated dark wallpapers together so this is meant as a quick first pass.
+var AHASH Hasher = New("ahash", 10.0, func(img image.Image) []uint64 {
+	return []uint64{Ahash(img)}
+}, nil)
+
+// The radial hash is compared by the peak cross correlation of it's features rather than bits,
+// see RadishDistance. pHash considers a correlation of 0.9 a match but comparing every shift of the
+// raw features is more forgiving and the wallpaper images start matching each other from 0.95 down.
+// Rotated copies of the cat image stay within a distance of 3 at any angle.
+// The distance isn't a true metric so these are searched by comparing against every hash.
+var RADISH Hasher = NewNonMetric("radish", 5.0, Radish, RadishDistance)
+
+// Against the cat images the resized, darkened, distorted and saturated copies fall within 8
+// with the greyscale and inverted ones right on 10, while the other cats are 24 and up.
+// The wallpaper images start to chain together past this.
+var WHASH Hasher = New("whash", 10.0, func(img image.Image) []uint64 {
+	return []uint64{Whash(img)}
+}, nil)
+
+func init() {
+	for _, h := range []Hasher{AHASH, DHASH, DCT, RADISH, WHASH} {
+		Register(h)
+	}
+}
@@ -0,0 +1,62 @@
+package hash
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestRegisterHasher(t *testing.T) {
+	custom := New("test-constant", 1, func(img image.Image) []uint64 {
+		return []uint64{42}
+	}, nil)
+	Register(custom)
+	defer unregister(custom.Name())
+
+	h, ok := Lookup("test-constant")
+	if !ok || h != custom {
+		t.Fatal("A registered hasher should be found by it's name")
+	}
+	if !slices.Contains(Names(), "test-constant") {
+		t.Error("A registered hasher should be listed in the names")
+	}
+	if h.Distance([]uint64{0}, []uint64{0xf}) != 4 {
+		t.Error("A hasher without a distance should use the hamming distance")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering the same name twice should panic")
+		}
+	}()
+	Register(custom)
+}
+
+func TestWithThreshold(t *testing.T) {
+	h := WithThreshold(DCT, 12)
+	if h.Threshold() != 12 || h.Name() != DCT.Name() {
+		t.Error("WithThreshold should only change the threshold of the hasher")
+	}
+	h = WithThreshold(h, 14)
+	if h.Threshold() != 14 {
+		t.Error("WithThreshold should replace an earlier threshold")
+	}
+	if DCT.Threshold() != 22 {
+		t.Error("WithThreshold should not change the original hasher")
+	}
+}
+
+func TestIsMetric(t *testing.T) {
+	if !IsMetric(DCT) || !IsMetric(WithThreshold(DCT, 12)) {
+		t.Error("Hamming distance hashers should be a metric")
+	}
+	if IsMetric(RADISH) || IsMetric(WithThreshold(RADISH, 3)) {
+		t.Error("The radial hash should not be a metric, even with another threshold")
+	}
+	if !IsHamming(DCT) || !IsHamming(WithThreshold(DHASH, 12)) {
+		t.Error("Hashers without a distance should be compared by their hamming distance")
+	}
+	if IsHamming(RADISH) || IsHamming(Segmented(DCT)) {
+		t.Error("Hashers with their own distance shouldn't be compared by their hamming distance")
+	}
+}
@@ -0,0 +1,150 @@
+package hash
+
+import (
+	"image"
+	"math"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// The radial variance hash is based on pHash's ph_image_digest
+// https://github.com/aetilius/pHash/blob/master/src/pHash.cpp
+// and the design notes at https://phash.org/docs/design.html
+// Instead of treating the image as a grid it takes the variance of the pixels along lines
+// through the center of the image at each angle. Rotating the image around it's center
+// only shifts which angle sees which line, so the features are circularly shifted rather than
+// scrambled and comparing them at every shift finds the match regardless of rotation.
+//
+// pHash compresses the features with a dct before comparing them but a shifted sequence
+// doesn't have shifted dct coefficients, which loses the rotation handling that we want this for.
+// Instead the features are compared directly, one byte per angle.
+
+const radishAngles = 180
+
+// Larger images don't give any better features and are much slower to project
+const radishSize = 128
+
+// Compute the radial hash as radishAngles bytes packed into uint64s
+func Radish(img image.Image) []uint64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= 0 || h <= 0 {
+		return make([]uint64, (radishAngles+7)/8)
+	}
+	// Shrink the image keeping the aspect ratio so rotations by 90 degrees line up,
+	// this also takes care of the small blur pHash applies before projecting
+	scale := float64(radishSize) / float64(max(w, h))
+	w = max(1, int(math.Round(float64(w)*scale)))
+	h = max(1, int(math.Round(float64(h)*scale)))
+	im := utils.Resize(img, w, h, utils.Linear)
+
+	grey := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			grey[w*y+x] = colorToGrey(im.At(x, y))
+		}
+	}
+
+	features := radialVariance(grey, w, h)
+
+	// Scale the features into a byte each so the hash stays a reasonable size
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, f := range features {
+		lo = min(lo, f)
+		hi = max(hi, f)
+	}
+	hash := make([]uint64, (radishAngles+7)/8)
+	if hi == lo {
+		return hash
+	}
+	for i, f := range features {
+		b := uint64(math.Round(255 * (f - lo) / (hi - lo)))
+		hash[i/8] |= b << ((i % 8) * 8)
+	}
+	return hash
+}
+
+// The variance of the pixels along a line through the image center for each angle
+func radialVariance(grey []float64, w, h int) []float64 {
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	// Only sample within the circle that fits in the image, otherwise the corners would
+	// contribute to some angles and not others and the features change as the image rotates
+	radius := math.Min(cx, cy)
+
+	features := make([]float64, radishAngles)
+	for k := range radishAngles {
+		theta := float64(k) * math.Pi / radishAngles
+		dx, dy := math.Cos(theta), math.Sin(theta)
+		var sum, sumSq float64
+		var n int
+		for t := -radius; t <= radius; t++ {
+			x := int(math.Round(cx + t*dx))
+			y := int(math.Round(cy + t*dy))
+			if x < 0 || x >= w || y < 0 || y >= h {
+				continue
+			}
+			v := grey[w*y+x]
+			sum += v
+			sumSq += v * v
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		mean := sum / float64(n)
+		features[k] = sumSq/float64(n) - mean*mean
+	}
+	return features
+}
+
+func unpackRadish(hash []uint64) []float64 {
+	features := make([]float64, radishAngles)
+	for i := range features {
+		if i/8 >= len(hash) {
+			break
+		}
+		features[i] = float64((hash[i/8] >> ((i % 8) * 8)) & 0xff)
+	}
+	return features
+}
+
+// The distance between two radial hashes from the peak of their cross correlation over every
+// shift. A correlation of 1 is a perfect match and is scaled so 0.95 lands on a distance of 5.
+// It should be noted this is not a true metric as it doesn't hold to the triangle inequality,
+// so a vantage point tree could prune a branch it shouldn't and miss matches. RADISH is marked
+// as NonMetric so it's never searched that way.
+func RadishDistance(a, b []uint64) float64 {
+	x, y := unpackRadish(a), unpackRadish(b)
+	n := len(x)
+
+	var meanX, meanY float64
+	for i := range n {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var denX, denY float64
+	for i := range n {
+		denX += (x[i] - meanX) * (x[i] - meanX)
+		denY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	// A flat hash comes from a uniform image and only matches another flat one
+	if denX == 0 || denY == 0 {
+		if denX == denY {
+			return 0
+		}
+		return 100
+	}
+	den := math.Sqrt(denX * denY)
+
+	peak := 0.0
+	for d := range n {
+		var num float64
+		for i := range n {
+			num += (x[i] - meanX) * (y[(n+i-d)%n] - meanY)
+		}
+		peak = max(peak, num/den)
+	}
+	return (1 - peak) * 100
+}
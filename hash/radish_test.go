@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// Rotate the image a quarter turn clockwise
+func rotate90(img image.Image) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Set(b.Max.Y-1-y, x-b.Min.X, img.At(x, y))
+		}
+	}
+	return out
+}
+
+func TestRadishDistanceSymmetric(t *testing.T) {
+	a := []uint64{0x0102030405060708, 0xff00ff00ff00ff00}
+	b := []uint64{0x0807060504030201, 0x00ff00ff00ff00ff}
+	if RadishDistance(a, a) != 0 {
+		t.Error("The distance between the same hash should be zero")
+	}
+	if RadishDistance(a, b) != RadishDistance(b, a) {
+		t.Error("The distance between two hashes should always be the same")
+	}
+}
+
+func TestRadishRotation(t *testing.T) {
+	img, err := utils.LoadImage(filepath.Join("..", "testimages", "cats", "cat.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := Radish(img)
+	rotated := img
+	for range 3 {
+		rotated = rotate90(rotated)
+		if dist := RadishDistance(hash, Radish(rotated)); dist >= RADISH.Threshold() {
+			t.Errorf("A rotated copy should be a duplicate but has a distance of %f", dist)
+		}
+	}
+
+	kitten, err := utils.LoadImage(filepath.Join("..", "testimages", "cats", "kitten.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dist := RadishDistance(hash, Radish(kitten)); dist < RADISH.Threshold() {
+		t.Errorf("A different image should not be a duplicate but has a distance of %f", dist)
+	}
+}
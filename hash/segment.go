@@ -0,0 +1,210 @@
+package hash
+
+import (
+	"cmp"
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// Segment hashing follows the crop resistant hash from https://github.com/JohannesBuchner/imagehash
+// which is based on https://ieeexplore.ieee.org/document/6980335
+// The image is split into blobs of light and dark pixels and each blob is hashed on it's own.
+// The blobs follow the content of the image rather than it's edges so most of them are found
+// again in a cropped copy, where a hash of the whole image would be thrown off completely.
+//
+// imagehash splits light and dark at a fixed brightness, here it's the median so the same
+// blobs are found when the image has been brightened or darkened.
+
+// The size the image is shrunk to before it's segmented
+const segmentSize = 300
+
+// Blobs smaller than this many pixels of the shrunk image are ignored
+const minSegmentSize = 500
+
+// Only the largest blobs are hashed, small ones are likely noise and there can be a lot of them
+const maxSegments = 32
+
+// Find the bounds of the larger blobs of light and dark pixels of the image, largest first
+func Segments(img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil
+	}
+	im := utils.Resize(img, segmentSize, segmentSize, utils.Linear)
+	grey := make([]float64, segmentSize*segmentSize)
+	for y := range segmentSize {
+		for x := range segmentSize {
+			grey[segmentSize*y+x] = colorToGrey(im.At(x, y))
+		}
+	}
+	// Blur out fine detail so it doesn't break up the blobs, twice over is close enough to a gaussian
+	boxBlur(grey, segmentSize, segmentSize, 2)
+	boxBlur(grey, segmentSize, segmentSize, 2)
+
+	sorted := slices.Clone(grey)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	light := make([]bool, len(grey))
+	for i, v := range grey {
+		light[i] = v > median
+	}
+
+	type segment struct {
+		size   int
+		bounds image.Rectangle
+	}
+	var segments []segment
+	seen := make([]bool, len(grey))
+	var stack []int
+	for start := range grey {
+		if seen[start] {
+			continue
+		}
+		// Flood fill the blob of matching pixels around the start
+		seen[start] = true
+		stack = append(stack[:0], start)
+		s := segment{bounds: image.Rect(start%segmentSize, start/segmentSize, start%segmentSize+1, start/segmentSize+1)}
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%segmentSize, i/segmentSize
+			s.size++
+			s.bounds = s.bounds.Union(image.Rect(x, y, x+1, y+1))
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[0] >= segmentSize || n[1] < 0 || n[1] >= segmentSize {
+					continue
+				}
+				j := n[1]*segmentSize + n[0]
+				if !seen[j] && light[j] == light[i] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		if s.size >= minSegmentSize {
+			segments = append(segments, s)
+		}
+	}
+	slices.SortStableFunc(segments, func(a, b segment) int {
+		return cmp.Compare(b.size, a.size)
+	})
+	segments = segments[:min(len(segments), maxSegments)]
+
+	// Scale the bounds back up to the original image
+	rects := make([]image.Rectangle, len(segments))
+	w, h := bounds.Dx(), bounds.Dy()
+	for i, s := range segments {
+		r := image.Rect(
+			s.bounds.Min.X*w/segmentSize, s.bounds.Min.Y*h/segmentSize,
+			s.bounds.Max.X*w/segmentSize, s.bounds.Max.Y*h/segmentSize,
+		)
+		// Tiny images can scale a blob down to nothing
+		r.Max.X = max(r.Max.X, r.Min.X+1)
+		r.Max.Y = max(r.Max.Y, r.Min.Y+1)
+		rects[i] = r.Add(bounds.Min)
+	}
+	return rects
+}
+
+// Average each pixel with it's neighbours within the radius, rows and then columns
+func boxBlur(data []float64, w, h, radius int) {
+	tmp := make([]float64, max(w, h))
+	blur := func(get func(i int) float64, set func(i int, v float64), n int) {
+		var sum float64
+		var count int
+		for i := range min(radius, n) {
+			sum += get(i)
+			count++
+		}
+		for i := range n {
+			if j := i + radius; j < n {
+				sum += get(j)
+				count++
+			}
+			if j := i - radius - 1; j >= 0 {
+				sum -= get(j)
+				count--
+			}
+			tmp[i] = sum / float64(count)
+		}
+		for i := range n {
+			set(i, tmp[i])
+		}
+	}
+	for y := range h {
+		row := data[y*w : (y+1)*w]
+		blur(func(i int) float64 { return row[i] }, func(i int, v float64) { row[i] = v }, w)
+	}
+	for x := range w {
+		blur(func(i int) float64 { return data[i*w+x] }, func(i int, v float64) { data[i*w+x] = v }, h)
+	}
+}
+
+// Pack a hash for each region of an image into one. The first value is the length of each
+// region hash and the rest are the region hashes one after another.
+func PackRegions(regions [][]uint64) []uint64 {
+	if len(regions) == 0 {
+		return nil
+	}
+	packed := []uint64{uint64(len(regions[0]))}
+	for _, r := range regions {
+		packed = append(packed, r...)
+	}
+	return packed
+}
+
+// Split a hash from PackRegions back into the hash of each region
+func UnpackRegions(packed []uint64) (regions [][]uint64) {
+	if len(packed) == 0 || packed[0] == 0 {
+		return nil
+	}
+	size := int(packed[0])
+	for i := 1; i+size <= len(packed); i += size {
+		regions = append(regions, packed[i:i+size])
+	}
+	return
+}
+
+type segmented struct {
+	Hasher
+}
+
+func (s segmented) Name() string { return s.Hasher.Name() + "+segments" }
+
+func (s segmented) Hash(img image.Image) []uint64 {
+	var regions [][]uint64
+	for _, r := range Segments(img) {
+		region := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(region, region.Bounds(), img, r.Min, draw.Src)
+		regions = append(regions, s.Hasher.Hash(region))
+	}
+	return PackRegions(regions)
+}
+
+// The distance between the closest pair of regions, two images that share any region are
+// close. This isn't a metric so it's meant for comparing a couple of images, a vptree.RegionTree
+// is the way to search through many of them.
+func (s segmented) Distance(a, b []uint64) float64 {
+	// Images without any segments, like a blank one, don't match anything
+	closest := math.Inf(1)
+	for _, x := range UnpackRegions(a) {
+		for _, y := range UnpackRegions(b) {
+			closest = min(closest, s.Hasher.Distance(x, y))
+		}
+	}
+	return closest
+}
+
+// Hash each segment of an image with the given hasher instead of the whole image. Each region
+// hash is compared with the hasher's distance and threshold. The name is the hasher's with a
+// +segments suffix so cached hashes don't get mixed up.
+func Segmented(h Hasher) Hasher {
+	if _, ok := h.(segmented); ok {
+		return h
+	}
+	return segmented{h}
+}
@@ -0,0 +1,25 @@
+package hash
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestSegmentsUniform(t *testing.T) {
+	img := image.NewGray(image.Rect(10, 10, 110, 60))
+	segments := Segments(img)
+	if len(segments) != 1 || segments[0] != img.Bounds() {
+		t.Errorf("A uniform image should be a single segment covering it but got %v", segments)
+	}
+}
+
+func TestPackRegions(t *testing.T) {
+	regions := [][]uint64{{1, 2}, {3, 4}, {5, 6}}
+	if got := UnpackRegions(PackRegions(regions)); !slices.EqualFunc(got, regions, slices.Equal) {
+		t.Errorf("Expected %v after packing but got %v", regions, got)
+	}
+	if UnpackRegions(PackRegions(nil)) != nil {
+		t.Error("No regions should stay empty")
+	}
+}
@@ -0,0 +1,78 @@
+package hash
+
+import (
+	"image"
+	"slices"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+// The wavelet hash follows the whash from https://github.com/JohannesBuchner/imagehash
+// The image is broken down with a haar wavelet and the hash is taken from the low frequency
+// band like the dct hash does, but the haar basis is made of blocks rather than cosines so
+// it reacts differently to things like compression artifacts, text and hard edges.
+//
+// imagehash also removes the lowest frequency before taking the hash but that only shifts
+// every coefficient by the same amount, which the median threshold here doesn't care about.
+
+// Decompose a square image in place with a single level of the 2d haar transform. Only the top
+// left size x size block is transformed and the low frequency band ends up in it's top left quarter.
+func haar2d(data []float64, stride, size int) {
+	half := size / 2
+	tmp := make([]float64, size)
+	// Rows first and then columns, each pair becomes an average and a difference
+	for y := range size {
+		row := data[y*stride : y*stride+size]
+		for i := range half {
+			a, b := row[2*i], row[2*i+1]
+			tmp[i] = (a + b) / 2
+			tmp[half+i] = (a - b) / 2
+		}
+		copy(row, tmp)
+	}
+	for x := range size {
+		for i := range half {
+			a, b := data[(2*i)*stride+x], data[(2*i+1)*stride+x]
+			tmp[i] = (a + b) / 2
+			tmp[half+i] = (a - b) / 2
+		}
+		for i := range size {
+			data[i*stride+x] = tmp[i]
+		}
+	}
+}
+
+func Whash(img image.Image) (hash uint64) {
+	// This needs to be a power of two to keep halving down to the 8x8 band
+	// TODO: there should be a way to account for images that are smaller than the target size
+	size := 64
+	regionSize := 8
+	img = utils.Resize(img, size, size, utils.Linear)
+
+	grey := make([]float64, size*size)
+	for y := range size {
+		for x := range size {
+			grey[size*y+x] = colorToGrey(img.At(x, y))
+		}
+	}
+
+	for level := size; level > regionSize; level /= 2 {
+		haar2d(grey, size, level)
+	}
+
+	band := make([]float64, 0, regionSize*regionSize)
+	for y := range regionSize {
+		band = append(band, grey[size*y:size*y+regionSize]...)
+	}
+
+	sorted := slices.Clone(band)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+
+	for n, v := range band {
+		if v > median {
+			hash |= 1 << n
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package hash
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+func TestHaarConstant(t *testing.T) {
+	size := 8
+	data := make([]float64, size*size)
+	for i := range data {
+		data[i] = 3
+	}
+	haar2d(data, size, size)
+	for y := range size {
+		for x := range size {
+			v := data[size*y+x]
+			if x < size/2 && y < size/2 && v != 3 {
+				t.Errorf("The low band of a constant signal should keep it's value but got %f", v)
+			} else if (x >= size/2 || y >= size/2) && v != 0 {
+				t.Errorf("The detail bands of a constant signal should be zero but got %f", v)
+			}
+		}
+	}
+}
+
+func TestZeroWhash(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := range 100 {
+		for x := range 100 {
+			img.Set(x, y, color.White)
+		}
+	}
+	if Whash(img) != 0 {
+		t.Error("The wavelet hash for a uniform white image should be zero")
+	}
+}
+
+func TestWhashCats(t *testing.T) {
+	load := func(name string) uint64 {
+		img, err := utils.LoadImage(filepath.Join("..", "testimages", "cats", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Whash(img)
+	}
+	cat := load("cat.jpg")
+	for _, name := range []string{"cat-dark.jpg", "cat-distorted.jpg", "cat-saturated.jpg", "cat-shrink.jpg", "cat-upscaled.jpg"} {
+		if dist := Hamming(cat, load(name)); float64(dist) >= WHASH.Threshold() {
+			t.Errorf("%s should be a duplicate of cat.jpg but has a distance of %d", name, dist)
+		}
+	}
+	for _, name := range []string{"cat-on-couch.jpg", "kitten.jpg", "kitten-looking-up.jpg"} {
+		if dist := Hamming(cat, load(name)); float64(dist) < WHASH.Threshold() {
+			t.Errorf("%s should not be a duplicate of cat.jpg but has a distance of %d", name, dist)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package dedupe
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A Ranking compares two files by how much more worth keeping one is than the other. It returns
+// a negative number when a should be kept over b, positive when b should be, and zero when
+// it can't tell them apart so the next ranking gets a say.
+type Ranking func(a, b File) int
+
+var (
+	// Keep the file with the most pixels
+	LargestResolution Ranking = func(a, b File) int {
+		return cmp.Compare(b.Width*b.Height, a.Width*a.Height)
+	}
+	// Keep the largest file
+	LargestSize Ranking = func(a, b File) int {
+		return cmp.Compare(b.Size, a.Size)
+	}
+	// Keep the file that was modified first. Copies are often made long after the photo so
+	// FirstTaken is usually better for photos with EXIF data.
+	Oldest Ranking = func(a, b File) int {
+		return a.ModTime.Compare(b.ModTime)
+	}
+	// Keep the file that was modified last
+	Newest Ranking = func(a, b File) int {
+		return b.ModTime.Compare(a.ModTime)
+	}
+	// Keep the photo that was taken first by it's EXIF date, files without one are ranked by when
+	// they were modified instead
+	FirstTaken Ranking = func(a, b File) int {
+		return a.taken().Compare(b.taken())
+	}
+	// Keep the file with the shortest path, copies tend to end up nested deeper or with a suffix
+	ShortestPath Ranking = func(a, b File) int {
+		return cmp.Compare(len(a.Path), len(b.Path))
+	}
+	// Keep the JPEG saved at the highest quality, anything that isn't a JPEG isn't lossy
+	// so it's considered better than any of them
+	BestQuality Ranking = func(a, b File) int {
+		quality := func(f File) int {
+			if f.Quality == 0 {
+				return 101
+			}
+			return f.Quality
+		}
+		return cmp.Compare(quality(b), quality(a))
+	}
+)
+
+var Rankings = map[string]Ranking{
+	"resolution":    LargestResolution,
+	"size":          LargestSize,
+	"oldest":        Oldest,
+	"newest":        Newest,
+	"taken":         FirstTaken,
+	"shortest-path": ShortestPath,
+	"quality":       BestQuality,
+}
+
+// When the photo was taken, or modified when the EXIF data doesn't say
+func (f File) taken() time.Time {
+	if f.Taken.IsZero() {
+		return f.ModTime
+	}
+	return f.Taken
+}
+
+// Keep files under the earlier directories first, files that aren't under
+// any of them are ranked after all of those that are
+func PreferPaths(dirs ...string) Ranking {
+	abs := absDirs(dirs)
+	return func(a, b File) int {
+		return cmp.Compare(dirIndex(abs, a.Path), dirIndex(abs, b.Path))
+	}
+}
+
+func absDirs(dirs []string) (abs []string) {
+	for _, d := range dirs {
+		if a, err := filepath.Abs(d); err == nil {
+			abs = append(abs, a)
+		}
+	}
+	return
+}
+
+// The index of the first directory the file is under, or the number of directories if it's in none
+func dirIndex(abs []string, file string) int {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return len(abs)
+	}
+	for i, dir := range abs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return i
+		}
+	}
+	return len(abs)
+}
+
+// Parse a comma separated list of ranking names, like resolution,size.
+// The prefer ranking uses the given directories, see PreferPaths.
+func ParseRankings(names string, preferred ...string) (rankings []Ranking, err error) {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "prefer" {
+			if len(preferred) == 0 {
+				err = errors.Join(err, errors.New("no preferred directories given to keep files from"))
+			}
+			rankings = append(rankings, PreferPaths(preferred...))
+			continue
+		}
+		r, ok := Rankings[name]
+		if !ok {
+			err = errors.Join(err, fmt.Errorf("unknown keep policy %s", name))
+			continue
+		}
+		rankings = append(rankings, r)
+	}
+	return
+}
+
+// Sort the files of a group from the most to the least worth keeping, so the first file is the
+// one to keep. Each ranking breaks the ties of the ones before it and the path breaks any left
+// so the order is the same between runs.
+func Rank(files []File, rankings ...Ranking) {
+	slices.SortStableFunc(files, func(a, b File) int {
+		for _, r := range rankings {
+			if c := r(a, b); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.Path, b.Path)
+	})
+}
+
+// Sort each group of duplicates with the most worth keeping first, see Rank.
+// This reads the metadata of every file to rank them by.
+func RankGroups(duplicates [][]string, rankings ...Ranking) (err error) {
+	for _, group := range duplicates {
+		files, e := describeGroup(group)
+		err = errors.Join(err, e)
+		Rank(files, rankings...)
+		for i, f := range files {
+			group[i] = f.Path
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package dedupe
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alexgQQ/dedupe/utils"
+)
+
+func TestRank(t *testing.T) {
+	now := time.Now()
+	files := []File{
+		{Path: "photos/copy/b.jpg", Size: 300, ModTime: now, Metadata: utils.Metadata{Width: 100, Height: 100, Quality: 90, Taken: now.Add(-3 * time.Hour)}},
+		{Path: "photos/a.jpg", Size: 200, ModTime: now.Add(-time.Hour), Metadata: utils.Metadata{Width: 200, Height: 100, Quality: 75}},
+		{Path: "backup/a.png", Size: 900, ModTime: now.Add(time.Hour), Metadata: utils.Metadata{Width: 100, Height: 100}},
+		{Path: "photos/c.jpg", Size: 200, ModTime: now.Add(-2 * time.Hour), Metadata: utils.Metadata{Width: 100, Height: 200, Quality: 50}},
+	}
+	testCases := []struct {
+		name     string
+		rankings []Ranking
+		want     []string
+	}{
+		{"none", nil, []string{"backup/a.png", "photos/a.jpg", "photos/c.jpg", "photos/copy/b.jpg"}},
+		{"resolution", []Ranking{LargestResolution}, []string{"photos/a.jpg", "photos/c.jpg", "backup/a.png", "photos/copy/b.jpg"}},
+		{"resolution then size", []Ranking{LargestResolution, LargestSize}, []string{"photos/a.jpg", "photos/c.jpg", "backup/a.png", "photos/copy/b.jpg"}},
+		{"size", []Ranking{LargestSize}, []string{"backup/a.png", "photos/copy/b.jpg", "photos/a.jpg", "photos/c.jpg"}},
+		{"oldest", []Ranking{Oldest}, []string{"photos/c.jpg", "photos/a.jpg", "photos/copy/b.jpg", "backup/a.png"}},
+		{"taken", []Ranking{FirstTaken}, []string{"photos/copy/b.jpg", "photos/c.jpg", "photos/a.jpg", "backup/a.png"}},
+		{"newest", []Ranking{Newest}, []string{"backup/a.png", "photos/copy/b.jpg", "photos/a.jpg", "photos/c.jpg"}},
+		{"shortest path", []Ranking{ShortestPath}, []string{"backup/a.png", "photos/a.jpg", "photos/c.jpg", "photos/copy/b.jpg"}},
+		{"quality", []Ranking{BestQuality}, []string{"backup/a.png", "photos/copy/b.jpg", "photos/a.jpg", "photos/c.jpg"}},
+		{"prefer", []Ranking{PreferPaths("photos/copy", "photos"), Oldest}, []string{"photos/copy/b.jpg", "photos/c.jpg", "photos/a.jpg", "backup/a.png"}},
+	}
+	for _, tc := range testCases {
+		ranked := slices.Clone(files)
+		Rank(ranked, tc.rankings...)
+		var got []string
+		for _, f := range ranked {
+			got = append(got, f.Path)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s ranked %v but expected %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRankings(t *testing.T) {
+	if r, err := ParseRankings("resolution, size,prefer", "photos"); err != nil || len(r) != 3 {
+		t.Errorf("Expected three rankings but got %d %v", len(r), err)
+	}
+	if _, err := ParseRankings("prefer"); err == nil {
+		t.Error("Preferring directories without any should fail")
+	}
+	if _, err := ParseRankings("biggest"); err == nil {
+		t.Error("An unknown policy should fail")
+	}
+}
+
+func TestKeepLargest(t *testing.T) {
+	d := Deduper{Hasher: DCT, Keep: []Ranking{LargestResolution}}
+	for range 3 {
+		// The tree is built in a random order so make sure it isn't what decides the keeper
+		duplicates, _, err := d.Duplicates([]string{"testimages/cats/cat-shrink.jpg", "testimages/cats/cat.jpg", "testimages/cats/cat-upscaled.jpg"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(duplicates) != 1 || duplicates[0][0] != "testimages/cats/cat-upscaled.jpg" {
+			t.Errorf("Expected the upscaled cat to be kept first but got %v", duplicates)
+		}
+	}
+}
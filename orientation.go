@@ -0,0 +1,131 @@
+package dedupe
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/alexgQQ/dedupe/utils"
+	"github.com/alexgQQ/dedupe/vptree"
+)
+
+// Matching any orientation is done at query time, the tree only holds the usual orientation of
+// each image and is queried with the hashes of every orientation of the target. A match in any
+// of them counts and the closest distance is kept. Mirroring or rotating the image doesn't map
+// neatly onto the hash bits so each orientation is hashed from the transformed image.
+
+// Every combination of 90 degree rotations and mirroring, in EXIF numbering, see utils.Orient
+var allOrientations = []int{
+	utils.OrientNormal,
+	utils.OrientFlipH,
+	utils.OrientRotate180,
+	utils.OrientFlipV,
+	utils.OrientTranspose,
+	utils.OrientRotate90,
+	utils.OrientTransverse,
+	utils.OrientRotate270,
+}
+
+func (d *Deduper) orientations() []int {
+	if d.AnyOrientation {
+		return allOrientations
+	}
+	return allOrientations[:1]
+}
+
+// An item to query with for each orientation that was hashed, all sharing the same ID
+func (d *Deduper) orientedItems(id uint, hashes [][][]uint64) []vptree.Item {
+	items := make([]vptree.Item, len(hashes))
+	for i, h := range hashes {
+		items[i] = vptree.Item{ID: id, Hashes: h[0]}
+		if len(d.Hashers) > 0 {
+			items[i].All = h
+		}
+	}
+	return items
+}
+
+// Find anything within the radius of any of the targets, keeping the smallest distance for each
+func withinAny(tree searcher, targets []vptree.Item, radius float64) (found []vptree.Item, distances []float64) {
+	seen := make(map[uint]int)
+	for _, target := range targets {
+		results, dists := tree.Within(target, radius)
+		for i, item := range results {
+			if j, ok := seen[item.ID]; ok {
+				distances[j] = min(distances[j], dists[i])
+				continue
+			}
+			seen[item.ID] = len(found)
+			found = append(found, item)
+			distances = append(distances, dists[i])
+		}
+	}
+	return
+}
+
+// Find the k closest items to any of the targets, sorted by their smallest distance
+func searchAny(tree *vptree.VPTree, targets []vptree.Item, k int) ([]vptree.Item, []float64) {
+	if len(targets) == 1 {
+		return tree.Search(targets[0], k)
+	}
+	type result struct {
+		item     vptree.Item
+		distance float64
+	}
+	seen := make(map[uint]int)
+	var results []result
+	for _, target := range targets {
+		found, dists := tree.Search(target, k)
+		for i, item := range found {
+			if j, ok := seen[item.ID]; ok {
+				results[j].distance = min(results[j].distance, dists[i])
+				continue
+			}
+			seen[item.ID] = len(results)
+			results = append(results, result{item, dists[i]})
+		}
+	}
+	slices.SortFunc(results, func(a, b result) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.item.ID, b.item.ID))
+	})
+	results = results[:min(k, len(results))]
+
+	items := make([]vptree.Item, len(results))
+	distances := make([]float64, len(results))
+	for i, r := range results {
+		items[i] = r.item
+		distances[i] = r.distance
+	}
+	return items, distances
+}
+
+// A tree or forest that matches each item in any orientation
+type orientedSearcher struct {
+	searcher
+	// The items for every orientation of each image, indexed by ID
+	orientations [][]vptree.Item
+}
+
+func (o *orientedSearcher) Within(target vptree.Item, radius float64) ([]vptree.Item, []float64) {
+	if int(target.ID) >= len(o.orientations) || o.orientations[target.ID] == nil {
+		return o.searcher.Within(target, radius)
+	}
+	return withinAny(o.searcher, o.orientations[target.ID], radius)
+}
+
+// The closest two items are with either of them in any orientation
+func (o *orientedSearcher) Distance(a, b vptree.Item) float64 {
+	distance := o.searcher.Distance(a, b)
+	for _, item := range []vptree.Item{a, b} {
+		if int(item.ID) >= len(o.orientations) {
+			continue
+		}
+		other := b
+		if item.ID == b.ID {
+			other = a
+		}
+		for _, oriented := range o.orientations[item.ID] {
+			distance = min(distance, o.searcher.Distance(oriented, other))
+		}
+	}
+	return distance
+}
@@ -0,0 +1,64 @@
+package dedupe
+
+import (
+	"bytes"
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/utils"
+	"github.com/alexgQQ/dedupe/vptree"
+)
+
+func TestAnyOrientation(t *testing.T) {
+	var transforms []func(image.Image) image.Image
+	for _, o := range []int{utils.OrientFlipH, utils.OrientRotate90, utils.OrientTransverse} {
+		transforms = append(transforms, func(img image.Image) image.Image { return utils.Orient(img, o) })
+	}
+	oriented := writeCats(t, transforms...)
+	files := append([]string{"testimages/cats/kitten.jpg"}, oriented...)
+
+	d := Deduper{Hasher: DCT}
+	found, err := d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Flipped and rotated images shouldn't match by default but found %v", found)
+	}
+
+	d.AnyOrientation = true
+	found, err = d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(found)
+	if !slices.Equal(found, oriented) {
+		t.Errorf("Expected %v to match in any orientation but found %v", oriented, found)
+	}
+
+	duplicates, total, err := d.Duplicates(append(files, "testimages/cats/cat.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 1 || total != len(oriented)+1 {
+		t.Errorf("Expected the cat in every orientation to be one group but found %v", duplicates)
+	}
+
+	// An index keeps every orientation so it matches them once it's loaded again
+	idx, err := d.BuildIndex(append(files, "testimages/cats/cat.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = vptree.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	duplicates, total = d.DuplicatesIndex(idx)
+	if len(duplicates) != 1 || total != len(oriented)+1 {
+		t.Errorf("Expected the cat in every orientation to be one group in the index but found %v", duplicates)
+	}
+}
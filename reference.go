@@ -0,0 +1,30 @@
+package dedupe
+
+// References are directories of originals. Files under them are always kept over any
+// duplicates found elsewhere and are never moved or deleted.
+type References []string
+
+// Check if a file is under any of the reference directories
+func (r References) Contains(file string) bool {
+	abs := absDirs(r)
+	return dirIndex(abs, file) < len(abs)
+}
+
+// Rank files under the reference directories first, this should come before any other ranking
+func (r References) Ranking() Ranking {
+	return PreferPaths(r...)
+}
+
+// Find the files of a ranked group that can be acted on, which are any that aren't under a
+// reference directory. The first file is the one kept so it's left out too unless all is set,
+// rank the group with Ranking first so a reference file is the one kept when there is one.
+func (r References) Actionable(group []string, all bool) (files []string) {
+	abs := absDirs(r)
+	for i, file := range group {
+		if dirIndex(abs, file) < len(abs) || (i == 0 && !all) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package dedupe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	refs := References{"originals", "backup/originals"}
+	if !refs.Contains("originals/a.jpg") || !refs.Contains("backup/originals/nested/b.jpg") {
+		t.Error("Expected files under the reference directories to be contained")
+	}
+	if refs.Contains("originals-copy/a.jpg") || refs.Contains("backup/c.jpg") {
+		t.Error("Expected files outside the reference directories to not be contained")
+	}
+
+	files := []File{{Path: "copies/a.jpg"}, {Path: "backup/originals/a.jpg"}, {Path: "a.jpg"}}
+	Rank(files, refs.Ranking(), ShortestPath)
+	if files[0].Path != "backup/originals/a.jpg" {
+		t.Errorf("Expected the reference file to be ranked first but got %v", files)
+	}
+
+	testCases := []struct {
+		group []string
+		all   bool
+		want  []string
+	}{
+		{[]string{"originals/a.jpg", "copies/a.jpg", "a.jpg"}, false, []string{"copies/a.jpg", "a.jpg"}},
+		{[]string{"originals/a.jpg", "copies/a.jpg", "a.jpg"}, true, []string{"copies/a.jpg", "a.jpg"}},
+		{[]string{"originals/a.jpg", "originals/b.jpg"}, true, nil},
+		{[]string{"copies/a.jpg", "a.jpg"}, false, []string{"a.jpg"}},
+		{[]string{"copies/a.jpg", "a.jpg"}, true, []string{"copies/a.jpg", "a.jpg"}},
+	}
+	for _, tc := range testCases {
+		if got := refs.Actionable(tc.group, tc.all); !slices.Equal(got, tc.want) {
+			t.Errorf("Expected %v to act on %v but got %v", tc.group, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"time"
+
+	"github.com/alexgQQ/dedupe/hash"
+	"github.com/alexgQQ/dedupe/utils"
+	"github.com/alexgQQ/dedupe/vptree"
+)
+
+// A File is an image from the results along with what we know about it, which helps with
+// telling which copy of a duplicate is the original
+type File struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// The dimensions, format and any EXIF data like when the photo was taken and on what camera
+	utils.Metadata
+}
+
+// Stat and read the metadata of a file. Whatever can be read is kept even on an error.
+func describe(path string) (f File, err error) {
+	f.Path = path
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	f.Size = info.Size()
+	f.ModTime = info.ModTime()
+	f.Metadata, err = utils.ReadMetadata(path)
+	return
+}
+
+// Stat and read the metadata of each file. Whatever can be read is kept even on an error.
+func Describe(paths ...string) ([]File, error) {
+	return describeGroup(paths)
+}
+
+func describeGroup(paths []string) (files []File, err error) {
+	files = make([]File, len(paths))
+	for i, path := range paths {
+		var e error
+		if files[i], e = describe(path); e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to read metadata %s %w", path, e))
+		}
+	}
+	return
+}
+
+// Find groups of duplicate images like Duplicates but with the metadata of each file
+// hasher determines the hashing method, like dedupe.DCT or any other hash.Hasher
+func DuplicateFiles(hasher hash.Hasher, files []string) (groups [][]File, err error) {
+	d := Deduper{Hasher: hasher}
+	return d.DuplicateFiles(files)
+}
+
+// Find groups of duplicate images like Duplicates but with the metadata of each file
+func (d *Deduper) DuplicateFiles(files []string) (groups [][]File, err error) {
+	// Ranking needs the metadata too so it's done here rather than reading it twice
+	unranked := *d
+	unranked.Keep = nil
+	duplicates, _, err := unranked.Duplicates(files)
+	for _, group := range duplicates {
+		described, e := describeGroup(group)
+		err = errors.Join(err, e)
+		if len(d.Keep) > 0 {
+			Rank(described, d.Keep...)
+		}
+		groups = append(groups, described)
+	}
+	return
+}
+
+// Find any duplicate images of the target image like Compare but with the metadata of each file
+// hasher determines the hashing method, like dedupe.DCT or any other hash.Hasher
+func CompareFiles(hasher hash.Hasher, target string, files ...string) (found []File, err error) {
+	d := Deduper{Hasher: hasher}
+	return d.CompareFiles(target, files...)
+}
+
+// Find any duplicate images of the target image like Compare but with the metadata of each file
+func (d *Deduper) CompareFiles(target string, files ...string) (found []File, err error) {
+	unranked := *d
+	unranked.Keep = nil
+	filenames, err := unranked.Compare(target, files...)
+	if len(filenames) == 0 {
+		return
+	}
+	found, e := describeGroup(filenames)
+	err = errors.Join(err, e)
+	if len(d.Keep) > 0 {
+		Rank(found, d.Keep...)
+	}
+	return
+}
+
+// A group of duplicates along with how far apart each of them are
+type Group struct {
+	Files []string
+	// The distance between each pair of files by their index in Files. When matching on several
+	// hashes it's their combined score instead, where anything under 1 is a match.
+	Distances [][]float64
+}
+
+// Gives the distance between each pair of the files, see Group
+type distanceFunc func(files []string) [][]float64
+
+// Measure distances between the files in a tree. Files that aren't in the tree can be given
+// with their items in each orientation, the closest of those is used.
+func pairDistances(tree searcher, fileMap *vptree.FileMapper, extra map[string][]vptree.Item) distanceFunc {
+	var items map[string][]vptree.Item
+	return func(files []string) [][]float64 {
+		// Only look up the items once they are needed since it means walking the whole tree
+		if items == nil {
+			items = make(map[string][]vptree.Item, fileMap.Len()+len(extra))
+			for item := range tree.All() {
+				file := fileMap.ByID(item.ID)
+				items[file] = []vptree.Item{item}
+			}
+			maps.Copy(items, extra)
+		}
+		distances := make([][]float64, len(files))
+		for i := range files {
+			distances[i] = make([]float64, len(files))
+		}
+		for i := range files {
+			for j := i + 1; j < len(files); j++ {
+				d := math.Inf(1)
+				for _, a := range items[files[i]] {
+					for _, b := range items[files[j]] {
+						d = min(d, tree.Distance(a, b))
+					}
+				}
+				distances[i][j], distances[j][i] = d, d
+			}
+		}
+		return distances
+	}
+}
+
+func groups(duplicates [][]string, distances distanceFunc) (groups []Group) {
+	for _, files := range duplicates {
+		groups = append(groups, Group{Files: files, Distances: distances(files)})
+	}
+	return
+}
+
+// Find groups of duplicate images like Duplicates along with the distances between them
+func (d *Deduper) DuplicateGroups(files []string) (found []Group, total int, err error) {
+	duplicates, total, distances, err := d.duplicates(files)
+	return groups(duplicates, distances), total, err
+}
+
+// Find any duplicate images of the target image like Compare. The target is the first file of
+// the group so the distances to it are included, the group is empty if none are found.
+func (d *Deduper) CompareGroup(target string, files ...string) (group Group, err error) {
+	filenames, distances, err := d.compare(target, files...)
+	if len(filenames) > 0 {
+		files := append([]string{target}, filenames...)
+		group = Group{Files: files, Distances: distances(files)}
+	}
+	return
+}
+
+// Find groups of duplicate images within a prebuilt index like DuplicatesIndex along with the
+// distances between them. Unlike DuplicatesIndex these are ranked by the Keep option.
+func (d *Deduper) DuplicateGroupsIndex(idx *vptree.Index) (found []Group, total int, err error) {
+	duplicates, total, distances := d.duplicatesIndex(idx)
+	if len(d.Keep) > 0 {
+		err = RankGroups(duplicates, d.Keep...)
+	}
+	return groups(duplicates, distances), total, err
+}
+
+// Find any duplicate images of the target image within a prebuilt index like CompareGroup
+func (d *Deduper) CompareGroupIndex(idx *vptree.Index, target string) (group Group, err error) {
+	filenames, distances, err := d.compareIndex(idx, target)
+	if len(filenames) > 0 {
+		if len(d.Keep) > 0 {
+			err = errors.Join(err, RankGroups([][]string{filenames}, d.Keep...))
+		}
+		files := append([]string{target}, filenames...)
+		group = Group{Files: files, Distances: distances(files)}
+	}
+	return
+}
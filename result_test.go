@@ -0,0 +1,73 @@
+package dedupe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDuplicateFiles(t *testing.T) {
+	d := Deduper{Hasher: DCT}
+	groups, err := d.DuplicateFiles([]string{
+		"testimages/cats/cat.jpg",
+		"testimages/cats/cat-shrink.jpg",
+		"testimages/cats/kitten.jpg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("Expected a single pair of duplicates but got %v", groups)
+	}
+	var paths []string
+	for _, f := range groups[0] {
+		paths = append(paths, f.Path)
+		if f.Size == 0 || f.ModTime.IsZero() || f.Width == 0 || f.Height == 0 || f.Format != "jpeg" {
+			t.Errorf("Expected the size, time and dimensions of %s but got %+v", f.Path, f)
+		}
+	}
+	slices.Sort(paths)
+	if !slices.Equal(paths, []string{"testimages/cats/cat-shrink.jpg", "testimages/cats/cat.jpg"}) {
+		t.Errorf("Expected the cat and it's shrunk copy but got %v", paths)
+	}
+	if a, b := groups[0][0], groups[0][1]; a.Width*a.Height == b.Width*b.Height {
+		t.Error("The shrunk copy should be smaller than the original")
+	}
+}
+
+func TestDuplicateGroups(t *testing.T) {
+	d := Deduper{Hasher: DCT, Grouping: Strict, AnyOrientation: true}
+	missing := "testimages/cats/missing.jpg"
+	found, total, err := d.DuplicateGroups([]string{
+		"testimages/cats/cat.jpg",
+		"testimages/cats/cat-shrink.jpg",
+		"testimages/cats/cat-upscaled.jpg",
+		"testimages/cats/kitten.jpg",
+		missing,
+	})
+	if loadErrs := LoadErrors(err); len(loadErrs) != 1 || loadErrs[0].File != missing {
+		t.Errorf("Expected only %s to fail to load but got %v", missing, err)
+	}
+	if len(found) != 1 || total != 3 {
+		t.Fatalf("Expected a single group of three cats but got %v", found)
+	}
+	group := found[0]
+	for i := range group.Files {
+		if group.Distances[i][i] != 0 {
+			t.Errorf("Expected no distance from %s to itself", group.Files[i])
+		}
+		for j := range group.Files {
+			if d := group.Distances[i][j]; d != group.Distances[j][i] || d > DCT.Threshold() {
+				t.Errorf("Expected a symmetric distance within the threshold between %s and %s but got %v",
+					group.Files[i], group.Files[j], d)
+			}
+		}
+	}
+
+	compared, err := d.CompareGroup("testimages/cats/cat.jpg", "testimages/cats/cat-shrink.jpg", "testimages/cats/kitten.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compared.Files) != 2 || compared.Files[0] != "testimages/cats/cat.jpg" || compared.Distances[0][1] > DCT.Threshold() {
+		t.Errorf("Expected the target first with it's distance to the shrunk cat but got %+v", compared)
+	}
+}
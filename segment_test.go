@@ -0,0 +1,50 @@
+package dedupe
+
+import (
+	"image"
+	"image/draw"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+func TestSegmentsCropped(t *testing.T) {
+	// The left three quarters, the top 60% and everything but the top and left fifths
+	crops := []func(b image.Rectangle) image.Rectangle{
+		func(b image.Rectangle) image.Rectangle { return image.Rect(0, 0, b.Dx()*3/4, b.Dy()) },
+		func(b image.Rectangle) image.Rectangle { return image.Rect(0, 0, b.Dx(), b.Dy()*6/10) },
+		func(b image.Rectangle) image.Rectangle { return image.Rect(b.Dx()/5, b.Dy()/5, b.Dx(), b.Dy()) },
+	}
+	var transforms []func(image.Image) image.Image
+	for _, crop := range crops {
+		transforms = append(transforms, func(img image.Image) image.Image {
+			b := img.Bounds()
+			r := crop(b)
+			dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+			draw.Draw(dst, dst.Bounds(), img, r.Min.Add(b.Min), draw.Src)
+			return dst
+		})
+	}
+	cropped := writeCats(t, transforms...)
+	files := append([]string{"testimages/cats/kitten.jpg", "testimages/cats/cat-on-couch.jpg"}, cropped...)
+
+	d := Deduper{Hasher: DCT}
+	found, err := d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Cropped images shouldn't match the whole image hash but found %v", found)
+	}
+
+	d = Deduper{Hasher: hash.WithThreshold(DCT, 11), Segments: 2}
+	found, err = d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(found)
+	if !slices.Equal(found, cropped) {
+		t.Errorf("Expected %v to match by their segments but found %v", cropped, found)
+	}
+}
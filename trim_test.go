@@ -0,0 +1,63 @@
+package dedupe
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"testing"
+)
+
+func TestTrimBorders(t *testing.T) {
+	// Letterboxed, pillarboxed and padded out like a screenshot
+	pad := func(bg color.Color, inner func(b image.Rectangle) image.Rectangle) func(image.Image) image.Image {
+		return func(img image.Image) image.Image {
+			b := img.Bounds()
+			r := inner(b)
+			dst := image.NewNRGBA(image.Rect(0, 0, r.Max.X+r.Min.X, r.Max.Y+r.Min.Y))
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+			draw.Draw(dst, r, img, b.Min, draw.Src)
+			return dst
+		}
+	}
+	padded := writeCats(t,
+		pad(color.Black, func(b image.Rectangle) image.Rectangle { return image.Rect(0, b.Dy()/3, b.Dx(), b.Dy()/3+b.Dy()) }),
+		pad(color.Black, func(b image.Rectangle) image.Rectangle { return image.Rect(b.Dx()/2, 0, b.Dx()/2+b.Dx(), b.Dy()) }),
+		pad(color.White, func(b image.Rectangle) image.Rectangle { return image.Rect(40, 25, 40+b.Dx(), 25+b.Dy()) }),
+	)
+	files := append([]string{"testimages/cats/kitten.jpg"}, padded...)
+
+	d := Deduper{Hasher: DCT}
+	found, err := d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) == len(padded) {
+		t.Errorf("Expected the padding to throw off some of the matches but found %v", found)
+	}
+
+	d.TrimBorders = true
+	d.TrimTolerance = 16
+	found, err = d.Compare("testimages/cats/cat.jpg", files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(found)
+	if !slices.Equal(found, padded) {
+		t.Errorf("Expected %v to match once trimmed but found %v", padded, found)
+	}
+
+	// Targets are trimmed like the images of an index were, even without asking for it
+	idx, err := d.BuildIndex([]string{"testimages/cats/kitten.jpg", "testimages/cats/cat.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := Deduper{Hasher: DCT}
+	found, err = plain.CompareIndex(idx, padded[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(found, []string{"testimages/cats/cat.jpg"}) {
+		t.Errorf("Expected the padded target to match the cat in an index built with trimming but found %v", found)
+	}
+}
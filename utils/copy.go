@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Hard links can't cross filesystems and some filesystems don't have them at all. Those fail with
+// EPERM on linux, or EOPNOTSUPP like on some network filesystems, which are ENOTSUP elsewhere.
+// Linux also refuses with EPERM to link files the user doesn't own when protected_hardlinks is on.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EPERM) ||
+		errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, errors.ErrUnsupported)
+}
+
+// Copy a file by streaming it's contents to a new file, keeping it's permissions, modification
+// time and any extended attributes. The copy is compared to the original afterwards when verify is set.
+// Nothing is left behind if it fails.
+func copyFile(src, dst string, verify bool) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return
+	}
+	// It's only ours to write to until the copy is done, a read only file couldn't take
+	// the extended attributes otherwise
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	if err = copyXattrs(src, dst); err != nil {
+		return
+	}
+	// Set the permissions once nothing else needs writing, this isn't limited by the umask either
+	if err = os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return
+	}
+	// This goes last since writing anything else would change it
+	if err = os.Chtimes(dst, time.Time{}, info.ModTime()); err != nil {
+		return
+	}
+	if verify {
+		var want, got string
+		if want, err = Checksum(src); err != nil {
+			return
+		}
+		if got, err = Checksum(dst); err != nil {
+			return
+		}
+		if want != got {
+			err = fmt.Errorf("the copy %s doesn't match %s", dst, src)
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+// Copy the extended attributes of one file to another. Those in namespaces we aren't allowed to
+// set, like security or trusted without privileges, are skipped rather than failing the copy.
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if errors.Is(err, errors.ErrUnsupported) || size == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	names := make([]byte, size)
+	if size, err = syscall.Listxattr(src, names); err != nil {
+		return err
+	}
+	// The names are null terminated one after another
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		n, err := syscall.Getxattr(src, attr, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(src, attr, value); err != nil {
+			return err
+		}
+		err = syscall.Setxattr(dst, attr, value[:n], 0)
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, errors.ErrUnsupported) {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
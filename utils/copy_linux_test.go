@@ -0,0 +1,13 @@
+package utils
+
+import "syscall"
+
+func setTestXattr(file string) bool {
+	return syscall.Setxattr(file, "user.dedupe", []byte("test"), 0) == nil
+}
+
+func hasTestXattr(file string) bool {
+	value := make([]byte, 16)
+	n, err := syscall.Getxattr(file, "user.dedupe", value)
+	return err == nil && string(value[:n]) == "test"
+}
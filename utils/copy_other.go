@@ -0,0 +1,8 @@
+//go:build !linux
+
+package utils
+
+// Extended attributes are only copied on linux
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package utils
+
+func setTestXattr(file string) bool {
+	return false
+}
+
+func hasTestXattr(file string) bool {
+	return false
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.jpg"), filepath.Join(dir, "dst.jpg")
+	if err := os.WriteFile(src, []byte("image"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := setTestXattr(src)
+	// A read only file is the awkward case, the copy has to take it's attributes before it's made read only
+	os.Chmod(src, 0444)
+
+	if err := copyFile(src, dst, true); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0444 {
+		t.Errorf("Expected the copy to keep it's permissions but got %v", info.Mode())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected the copy to keep it's modification time but got %v", info.ModTime())
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "image" {
+		t.Errorf("Expected the copy to have the same contents but got %s", data)
+	}
+	if xattrs && !hasTestXattr(dst) {
+		t.Error("Expected the copy to keep it's extended attributes")
+	}
+
+	// An existing file is never overwritten or removed
+	if err := copyFile(src, dst, false); err == nil {
+		t.Error("Expected copying over an existing file to fail")
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("Expected the existing file to be left alone %v", err)
+	}
+}
+
+func TestLinkUnsupported(t *testing.T) {
+	for err, want := range map[error]bool{
+		&os.LinkError{Op: "link", Err: syscall.EXDEV}:      true,
+		&os.LinkError{Op: "link", Err: syscall.EPERM}:      true,
+		&os.LinkError{Op: "link", Err: syscall.ENOTSUP}:    true,
+		&os.LinkError{Op: "link", Err: syscall.EOPNOTSUPP}: true,
+		fmt.Errorf("wrapped %w", errors.ErrUnsupported):    true,
+		&os.LinkError{Op: "link", Err: syscall.EEXIST}:     false,
+		&os.LinkError{Op: "link", Err: syscall.EACCES}:     false,
+		nil: false,
+	} {
+		if linkUnsupported(err) != want {
+			t.Errorf("Expected %v to be unsupported %v", err, want)
+		}
+	}
+}
+
+func TestCopyAcrossFilesystems(t *testing.T) {
+	// A hard link can't be made from a tmpfs to anywhere else so the file has to be copied
+	src, err := os.MkdirTemp("/dev/shm", "copy-test")
+	if err != nil {
+		t.Skip("no /dev/shm to copy across filesystems from")
+	}
+	defer os.RemoveAll(src)
+	file := filepath.Join(src, "image.jpg")
+	if err := os.WriteFile(file, []byte("image"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "copied", "image.jpg")
+	if err := os.Link(file, filepath.Join(t.TempDir(), "link.jpg")); !linkUnsupported(err) {
+		t.Skip("/dev/shm is on the same filesystem as the temp directory")
+	}
+
+	if err := (Action{Op: Copy, Src: file, Dst: dst, Verify: true}).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "image" {
+		t.Errorf("Expected the copy to have the same contents but got %s", data)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected the original to be left alone %v", err)
+	}
+}
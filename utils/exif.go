@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A small EXIF reader, only enough of the spec to pull out the tags we care about.
+// https://www.cipa.jp/std/documents/e/DC-X008-Translation-2019-E.pdf
+// EXIF data is a TIFF structure, a header for the byte order followed by directories (IFDs)
+// of tagged values. It's found in the APP1 segment of a JPEG or the eXIf chunk of a PNG.
+
+var ErrNoExif = errors.New("no exif data found")
+
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagPixelXDimension    = 0xa002
+	tagPixelYDimension    = 0xa003
+)
+
+type exifTag struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type Exif struct {
+	order binary.ByteOrder
+	tags  map[uint16]exifTag
+}
+
+// Find and parse the EXIF data in the raw bytes of a JPEG or PNG file
+func ParseExif(data []byte) (*Exif, error) {
+	var tiff []byte
+	if bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		tiff = jpegExif(data)
+	} else if bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		tiff = pngExif(data)
+	}
+	if tiff == nil {
+		return nil, ErrNoExif
+	}
+	return parseTiff(tiff)
+}
+
+// Walk the JPEG segments up to the image data, calling fn with the marker and data of each
+// until it returns false
+func jpegSegments(data []byte, fn func(marker byte, segment []byte) bool) {
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			return
+		}
+		marker := data[i+1]
+		// Markers can be padded with any number of 0xff bytes
+		if marker == 0xff {
+			i++
+			continue
+		}
+		// Restart markers and the like don't have a length
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			i += 2
+			continue
+		}
+		// The image data starts at SOS and EOI is the end, metadata won't be past either
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return
+		}
+		if !fn(marker, data[i+4:i+2+length]) {
+			return
+		}
+		i += 2 + length
+	}
+}
+
+// Find the EXIF APP1 segment of a JPEG
+func jpegExif(data []byte) (tiff []byte) {
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			tiff = segment[6:]
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// Walk the PNG chunks looking for the eXIf chunk
+func pngExif(data []byte) []byte {
+	i := 8
+	for i+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		// Each chunk is the length, type, data and a crc
+		if length < 0 || i+12+length > len(data) {
+			return nil
+		}
+		if kind == "eXIf" {
+			return data[i+8 : i+8+length]
+		} else if kind == "IEND" {
+			return nil
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+func parseTiff(tiff []byte) (*Exif, error) {
+	if len(tiff) < 8 {
+		return nil, ErrNoExif
+	}
+	e := &Exif{tags: make(map[uint16]exifTag)}
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		e.order = binary.LittleEndian
+	case "MM\x00*":
+		e.order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	e.readIFD(tiff, e.order.Uint32(tiff[4:]))
+	// The camera specific tags live in their own directory pointed to from the first one
+	if t, ok := e.tags[tagExifIFD]; ok && len(t.value) >= 4 {
+		e.readIFD(tiff, e.order.Uint32(t.value))
+	}
+	return e, nil
+}
+
+// The size in bytes of each value type, indexed by type
+var exifTypeSizes = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// Read the tags of a directory, anything out of bounds is skipped rather than failing
+// the whole thing since a lot of software writes slightly broken EXIF data
+func (e *Exif) readIFD(tiff []byte, offset uint32) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return
+	}
+	count := int(e.order.Uint16(tiff[offset:]))
+	for n := range count {
+		start := uint64(offset) + 2 + uint64(n)*12
+		if start+12 > uint64(len(tiff)) {
+			return
+		}
+		entry := tiff[start : start+12]
+		tag := e.order.Uint16(entry)
+		typ := e.order.Uint16(entry[2:])
+		valueCount := e.order.Uint32(entry[4:])
+		if typ == 0 || int(typ) >= len(exifTypeSizes) {
+			continue
+		}
+		size := uint64(exifTypeSizes[typ]) * uint64(valueCount)
+		// Values that fit in 4 bytes are stored in place of the offset
+		var value []byte
+		if size <= 4 {
+			value = entry[8 : 8+size]
+		} else {
+			at := uint64(e.order.Uint32(entry[8:]))
+			if at+size > uint64(len(tiff)) {
+				continue
+			}
+			value = tiff[at : at+size]
+		}
+		// The first directory takes priority if a tag shows up twice
+		if _, ok := e.tags[tag]; !ok {
+			e.tags[tag] = exifTag{typ: typ, count: valueCount, value: value}
+		}
+	}
+}
+
+// Get a tag as an unsigned integer, it could be stored as a byte, short or long
+func (e *Exif) uint(tag uint16) (uint32, bool) {
+	t, ok := e.tags[tag]
+	if !ok || t.count < 1 {
+		return 0, false
+	}
+	switch t.typ {
+	case 1:
+		return uint32(t.value[0]), true
+	case 3:
+		return uint32(e.order.Uint16(t.value)), true
+	case 4:
+		return e.order.Uint32(t.value), true
+	}
+	return 0, false
+}
+
+// The orientation of the image following the numbering in utils.Orient,
+// anything missing or invalid is the usual orientation
+func (e *Exif) Orientation() int {
+	o, ok := e.uint(tagOrientation)
+	if !ok || o < OrientNormal || o > OrientRotate270 {
+		return OrientNormal
+	}
+	return int(o)
+}
+
+// Get a tag as a string without the null terminator or any padding
+func (e *Exif) string(tag uint16) string {
+	t, ok := e.tags[tag]
+	if !ok || t.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(t.value), "\x00"))
+}
+
+// The make of the camera that took the photo
+func (e *Exif) Make() string {
+	return e.string(tagMake)
+}
+
+// The model of the camera that took the photo
+func (e *Exif) Model() string {
+	return e.string(tagModel)
+}
+
+// When the photo was taken. EXIF times don't have a timezone unless an offset was saved
+// along with it, without one the local timezone is assumed.
+func (e *Exif) DateTimeOriginal() (time.Time, bool) {
+	value := e.string(tagDateTimeOriginal)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if offset := e.string(tagOffsetTimeOriginal); offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, time.Local)
+	return t, err == nil
+}
+
+// The pixel dimensions the camera recorded, which can differ from the image if it was edited
+func (e *Exif) PixelSize() (width, height int, ok bool) {
+	w, okW := e.uint(tagPixelXDimension)
+	h, okH := e.uint(tagPixelYDimension)
+	return int(w), int(h), okW && okH
+}
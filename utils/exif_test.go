@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Build a TIFF structure with the tags of the first directory and the exif directory,
+// values can be a uint16 for a short or a string
+func buildTiff(order binary.ByteOrder, ifd0, exifIFD map[uint16]any) []byte {
+	ifdSize := func(tags map[uint16]any) int { return 2 + 12*len(tags) + 4 }
+	if exifIFD != nil {
+		ifd0[tagExifIFD] = uint32(8 + ifdSize(ifd0) + 12)
+	}
+	dataOffset := 8 + ifdSize(ifd0) + ifdSize(exifIFD)
+	var data bytes.Buffer
+
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	binary.Write(&buf, order, uint32(8))
+	writeIFD := func(tags map[uint16]any) {
+		binary.Write(&buf, order, uint16(len(tags)))
+		for _, tag := range slices.Sorted(maps.Keys(tags)) {
+			binary.Write(&buf, order, tag)
+			switch v := tags[tag].(type) {
+			case uint16:
+				binary.Write(&buf, order, uint16(3))
+				binary.Write(&buf, order, uint32(1))
+				binary.Write(&buf, order, v)
+				binary.Write(&buf, order, uint16(0))
+			case uint32:
+				binary.Write(&buf, order, uint16(4))
+				binary.Write(&buf, order, uint32(1))
+				binary.Write(&buf, order, v)
+			case string:
+				v += "\x00"
+				binary.Write(&buf, order, uint16(2))
+				binary.Write(&buf, order, uint32(len(v)))
+				binary.Write(&buf, order, uint32(dataOffset+data.Len()))
+				data.WriteString(v)
+			}
+		}
+		binary.Write(&buf, order, uint32(0))
+	}
+	writeIFD(ifd0)
+	if exifIFD != nil {
+		writeIFD(exifIFD)
+	}
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+// Put the TIFF structure into an APP1 segment right after the start of the JPEG
+func withExif(jpg []byte, tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	var buf bytes.Buffer
+	buf.Write(jpg[:2])
+	buf.Write([]byte{0xff, 0xe1})
+	binary.Write(&buf, binary.BigEndian, uint16(len(segment)+2))
+	buf.Write(segment)
+	buf.Write(jpg[2:])
+	return buf.Bytes()
+}
+
+func TestExifOrientation(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseExif(jpg.Bytes()); !errors.Is(err, ErrNoExif) {
+		t.Errorf("A jpeg without exif data should fail with ErrNoExif but got %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := withExif(jpg.Bytes(), buildTiff(order, map[uint16]any{tagOrientation: uint16(OrientRotate90)}, nil))
+		exif, err := ParseExif(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o := exif.Orientation(); o != OrientRotate90 {
+			t.Errorf("Expected orientation %d in %v but got %d", OrientRotate90, order, o)
+		}
+
+		path := filepath.Join(dir, "rotated.jpg")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadImage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := loaded.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+			t.Errorf("The image should be rotated on load but has bounds %v", b)
+		}
+		raw, err := LoadImageRaw(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := raw.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+			t.Errorf("The raw image shouldn't be rotated but has bounds %v", b)
+		}
+	}
+}
+
+func TestExifInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("not an image"),
+		{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff},
+		withExif([]byte{0xff, 0xd8, 0xff, 0xd9}, []byte("II*\x00\xff\xff\xff\xff")),
+	} {
+		// Broken data should never panic, at worst there's no orientation
+		if exif, err := ParseExif(data); err == nil && exif.Orientation() != OrientNormal {
+			t.Errorf("Expected no orientation from %v", data)
+		}
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	tiff := buildTiff(binary.BigEndian,
+		map[uint16]any{tagMake: "Camera Co", tagModel: "Snapper 3 ", tagOrientation: uint16(OrientRotate270)},
+		map[uint16]any{tagDateTimeOriginal: "2021:06:05 14:30:00", tagOffsetTimeOriginal: "+02:00", tagPixelXDimension: uint32(4000), tagPixelYDimension: uint16(3000)},
+	)
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, withExif(jpg.Bytes(), tiff), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := ReadMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{
+		Width:       20,
+		Height:      40,
+		Format:      "jpeg",
+		Quality:     75,
+		Taken:       time.Date(2021, 6, 5, 12, 30, 0, 0, time.UTC),
+		Make:        "Camera Co",
+		Model:       "Snapper 3",
+		Orientation: OrientRotate270,
+	}
+	if !meta.Taken.Equal(want.Taken) {
+		t.Errorf("Expected the photo to be taken at %v but got %v", want.Taken, meta.Taken)
+	}
+	meta.Taken = want.Taken
+	if meta != want {
+		t.Errorf("Expected %+v but got %+v", want, meta)
+	}
+
+	exif, err := ParseExif(withExif(jpg.Bytes(), tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h, ok := exif.PixelSize(); !ok || w != 4000 || h != 3000 {
+		t.Errorf("Expected a pixel size of 4000x3000 but got %dx%d", w, h)
+	}
+
+	meta, err = ReadMetadata("../testimages/cats/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Width == 0 || meta.Height == 0 || meta.Format != "jpeg" || !meta.Taken.IsZero() {
+		t.Errorf("Expected only the dimensions and format without exif data but got %+v", meta)
+	}
+}
@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"errors"
+	"bytes"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
@@ -11,15 +11,36 @@ import (
 	"path/filepath"
 )
 
+// Load an image the way it's meant to be displayed, rotated or flipped by it's EXIF orientation.
+// Phones mostly save photos as the sensor sees them and rely on the orientation tag to show
+// them upright, without this they hash differently than an upright copy.
 func LoadImage(file string) (image.Image, error) {
-	f, err := os.Open(file)
+	return loadImage(file, true)
+}
+
+// Load an image as it is stored, ignoring any EXIF orientation
+func LoadImageRaw(file string) (image.Image, error) {
+	return loadImage(file, false)
+}
+
+func loadImage(file string, orient bool) (image.Image, error) {
+	// The whole file is read up front so the exif data can be found without opening it twice,
+	// this is small compared to the decoded image
+	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	img, _, err := image.Decode(f)
-	return img, err
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil || !orient {
+		return img, err
+	}
+	if exif, e := ParseExif(data); e == nil {
+		if o := exif.Orientation(); o != OrientNormal {
+			img = Orient(img, o)
+		}
+	}
+	return img, nil
 }
 
 func matchesAnyExt(path string, extensions []string) bool {
@@ -60,35 +81,32 @@ func FindImages(root string, subdirs bool) []string {
 }
 
 // Bubble up any errors without breaking the loop
-func MoveFiles(files []string, dir string) (e error) {
-	for _, src := range files {
-		filename := filepath.Base(src)
-		dst := filepath.Join(dir, filename)
-		err := os.Rename(src, dst)
-		e = errors.Join(e, err)
+func MoveFiles(files []string, dir string) error {
+	p, err := PlanMove(files, dir, Suffix, "")
+	if err != nil {
+		return err
 	}
-	return
+	return p.Run()
 }
 
 // Bubble up any errors without breaking the loop
-func CopyFiles(files []string, dir string) (e error) {
-	for _, src := range files {
-		filename := filepath.Base(src)
-		dst := filepath.Join(dir, filename)
-		// A hard link should be sufficient
-		err := os.Link(src, dst)
-		e = errors.Join(e, err)
+func CopyFiles(files []string, dir string) error {
+	p, err := PlanCopy(files, dir, Suffix, "")
+	if err != nil {
+		return err
 	}
-	return
+	return p.Run()
 }
 
+// Replace the files with links to the target, op is one of LinkModes.
 // Bubble up any errors without breaking the loop
-func DeleteFiles(files []string) (e error) {
-	for _, f := range files {
-		err := os.Remove(f)
-		e = errors.Join(e, err)
-	}
-	return
+func LinkFiles(files []string, target string, op Operation) error {
+	return PlanLink(files, target, op).Run()
+}
+
+// Bubble up any errors without breaking the loop
+func DeleteFiles(files []string) error {
+	return PlanDelete(files).Run()
 }
 
 func ImageOrDir(path string) (abs string, isImg bool, isDir bool) {
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// A journal is a record of the destructive actions taken on files, one json entry per line.
+// Each has the checksum of the file from before it was acted on so a file that has changed
+// since isn't mistaken for the original when putting it back.
+type JournalEntry struct {
+	Action
+	Checksum string `json:"checksum"`
+}
+
+// The sha256 of a file's contents
+func Checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func ReadJournal(r io.Reader) (entries []JournalEntry, err error) {
+	dec := json.NewDecoder(r)
+	for {
+		var entry JournalEntry
+		if err = dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Put back the files from a journal, starting from the last action taken. Files are only
+// restored if they are unchanged and nothing else has taken their original path.
+// Deleted files and those replaced by links are gone for good so those are reported as errors.
+// Bubble up any errors without breaking the loop.
+func Undo(entries []JournalEntry) (err error) {
+	for _, entry := range slices.Backward(entries) {
+		if e := restore(entry); e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to undo %s %w", entry.Action, e))
+		}
+	}
+	return
+}
+
+func restore(entry JournalEntry) error {
+	if entry.Op == Delete {
+		return errors.New("deleted files can't be restored")
+	} else if entry.Op == HardLink || entry.Op == SymLink || entry.Op == Reflink {
+		return errors.New("files replaced by links can't be restored")
+	} else if !entry.Op.Destructive() {
+		return nil
+	}
+	if _, err := os.Lstat(entry.Src); err == nil {
+		return fmt.Errorf("%s already exists", entry.Src)
+	}
+	sum, err := Checksum(entry.Dst)
+	if err != nil {
+		return err
+	}
+	if sum != entry.Checksum {
+		return fmt.Errorf("%s has changed since", entry.Dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Src), 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(entry.Dst, entry.Src); err != nil {
+		return err
+	}
+	if entry.Op == Trash {
+		// It's not in the trash anymore so a file manager shouldn't list it
+		return os.Remove(trashInfo(entry.Dst))
+	}
+	return nil
+}
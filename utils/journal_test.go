@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		files[name] = filepath.Join(dir, "photos", name)
+	}
+	os.MkdirAll(filepath.Join(dir, "photos"), 0750)
+	for name, path := range files {
+		if err := os.WriteFile(path, []byte(name), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var plan Plan
+	plan = append(plan, Action{Op: Move, Src: files["a.jpg"], Dst: filepath.Join(dir, "dups", "a.jpg")})
+	plan = append(plan, Action{Op: Move, Src: files["b.jpg"], Dst: filepath.Join(dir, "dups", "b.jpg")})
+	plan = append(plan, Action{Op: Copy, Src: files["c.jpg"], Dst: filepath.Join(dir, "copies", "c.jpg")})
+	plan = append(plan, PlanDelete([]string{files["d.jpg"]})...)
+	var journal bytes.Buffer
+	if err := plan.RunJournal(&journal); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadJournal(&journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected the moves and delete to be journaled but got %v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Checksum == "" {
+			t.Errorf("Expected a checksum for %s", entry.Action)
+		}
+	}
+
+	// A file changed after it was moved isn't the one that was moved anymore
+	if err := os.WriteFile(filepath.Join(dir, "dups", "b.jpg"), []byte("changed"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(entries); err == nil {
+		t.Error("Expected undoing a delete and a changed file to fail")
+	}
+	if data, err := os.ReadFile(files["a.jpg"]); err != nil || string(data) != "a.jpg" {
+		t.Errorf("Expected a.jpg to be restored but got %s %v", data, err)
+	}
+	if _, err := os.Stat(files["b.jpg"]); !os.IsNotExist(err) {
+		t.Error("Expected the changed b.jpg to not be restored")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "copies", "c.jpg")); err != nil {
+		t.Errorf("Expected copies to be left alone %v", err)
+	}
+}
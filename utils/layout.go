@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How files are laid out in the directory they are moved or copied to
+type Layout int
+
+const (
+	// Keep just the file name, adding a number to it if another file already has it
+	Suffix Layout = iota
+	// Keep the path of the file relative to a root directory
+	Mirror
+)
+
+var Layouts = map[string]Layout{
+	"suffix": Suffix,
+	"mirror": Mirror,
+}
+
+// Work out where each file goes under the directory so no two end up at the same path and
+// nothing already there is overwritten. With Mirror the paths are kept relative to root,
+// usually the CommonDir of all the files, and suffixes are only added if something is in the way.
+func Destinations(files []string, dir string, layout Layout, root string) (dsts []string, err error) {
+	taken := make(map[string]bool)
+	for _, file := range files {
+		name := filepath.Base(file)
+		if layout == Mirror {
+			if name, err = relative(root, file); err != nil {
+				return nil, err
+			}
+		}
+		dst := unique(filepath.Join(dir, name), taken)
+		taken[dst] = true
+		dsts = append(dsts, dst)
+	}
+	return
+}
+
+func relative(root, file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not under %s", file, root)
+	}
+	return rel, nil
+}
+
+// Add a number before the extension until the path isn't taken or already on disk, like IMG_0001-2.jpg
+func unique(path string, taken map[string]bool) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := path
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		}
+		if taken[candidate] {
+			continue
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// The deepest directory all of the files are under
+func CommonDir(files []string) (string, error) {
+	var common []string
+	for i, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", err
+		}
+		parts := strings.Split(filepath.Dir(abs), string(filepath.Separator))
+		if i == 0 {
+			common = parts
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return "", nil
+	}
+	dir := strings.Join(common, string(filepath.Separator))
+	// Splitting the root directory leaves an empty string behind
+	if dir == "" || strings.HasSuffix(dir, ":") {
+		dir += string(filepath.Separator)
+	}
+	return dir, nil
+}
+
+// Write where each file is moved or copied to as csv rows of the original and new path
+func (p Plan) WriteManifest(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	for _, a := range p {
+		if a.Op != Move && a.Op != Copy {
+			continue
+		}
+		if err := cw.Write([]string{a.Src, a.Dst}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
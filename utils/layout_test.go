@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDestinations(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dups")
+	os.MkdirAll(dst, 0750)
+	// Something already in the destination from an earlier run
+	os.WriteFile(filepath.Join(dst, "IMG_0001.jpg"), nil, 0640)
+
+	files := []string{
+		filepath.Join(dir, "photos", "2020", "IMG_0001.jpg"),
+		filepath.Join(dir, "photos", "2021", "IMG_0001.jpg"),
+		filepath.Join(dir, "photos", "2021", "IMG_0002.jpg"),
+	}
+	root, err := CommonDir(files)
+	if err != nil || root != filepath.Join(dir, "photos") {
+		t.Fatalf("Expected the common directory to be photos but got %s %v", root, err)
+	}
+
+	got, err := Destinations(files, dst, Suffix, root)
+	want := []string{filepath.Join(dst, "IMG_0001-2.jpg"), filepath.Join(dst, "IMG_0001-3.jpg"), filepath.Join(dst, "IMG_0002.jpg")}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("Expected suffixed destinations %v but got %v %v", want, got, err)
+	}
+
+	got, err = Destinations(files, dst, Mirror, root)
+	want = []string{filepath.Join(dst, "2020", "IMG_0001.jpg"), filepath.Join(dst, "2021", "IMG_0001.jpg"), filepath.Join(dst, "2021", "IMG_0002.jpg")}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("Expected mirrored destinations %v but got %v %v", want, got, err)
+	}
+
+	if _, err := Destinations(files, dst, Mirror, filepath.Join(dir, "photos", "2020")); err == nil {
+		t.Error("Expected mirroring files outside of the root to fail")
+	}
+	if root, _ := CommonDir([]string{"/a/b.jpg", "/c/d.jpg"}); root != string(filepath.Separator) {
+		t.Errorf("Expected the root directory to be common but got %s", root)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	plan := Plan{{Op: Move, Src: "a/b.jpg", Dst: "dups/b.jpg"}, {Op: Delete, Src: "c.jpg"}, {Op: Copy, Src: "d,e.jpg", Dst: "dups/d,e.jpg"}}
+	var buf bytes.Buffer
+	if err := plan.WriteManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "a/b.jpg,dups/b.jpg\n\"d,e.jpg\",\"dups/d,e.jpg\"\n"
+	if buf.String() != want {
+		t.Errorf("Expected manifest\n%s\nbut got\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Link modes for replacing a duplicate with a link to the file that's kept
+var LinkModes = map[string]Operation{
+	"hard":    HardLink,
+	"sym":     SymLink,
+	"reflink": Reflink,
+}
+
+// Returned when the filesystem can't share data between files, see reflink
+var errReflinkUnsupported = errors.New("reflinks aren't supported here")
+
+// Replace the file with a link to the target. The link is made next to the file first and
+// renamed over it so the path is never missing or half written, if anything fails it's left as is.
+// Reflinks share the data of the target but are otherwise their own file so they keep the
+// permissions of the file they replace. They fall back to a hard link on filesystems without them.
+func replaceWithLink(file, target string, op Operation) (err error) {
+	fileInfo, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return
+	}
+	// Already a link to the target, making another would change nothing
+	if os.SameFile(fileInfo, targetInfo) {
+		return nil
+	}
+
+	tmp := filepath.Join(filepath.Dir(file), fmt.Sprintf(".%s.dedupe-%08x", filepath.Base(file), rand.Uint32()))
+	switch op {
+	case HardLink:
+		err = os.Link(target, tmp)
+	case SymLink:
+		var abs string
+		if abs, err = filepath.Abs(target); err == nil {
+			err = os.Symlink(abs, tmp)
+		}
+	case Reflink:
+		err = reflink(target, tmp, fileInfo.Mode().Perm())
+		if errors.Is(err, errReflinkUnsupported) {
+			// The hard link error alone would be confusing when a reflink was asked for
+			if e := os.Link(target, tmp); errors.Is(e, syscall.EXDEV) {
+				err = fmt.Errorf("unable to reflink %s to %s, they are on different filesystems and neither a reflink or a hard link can cross them", file, target)
+			} else if e != nil {
+				err = fmt.Errorf("unable to reflink %s to %s, %w and a hard link can't be made instead %w", file, target, err, e)
+			} else {
+				err = nil
+			}
+		}
+	default:
+		err = fmt.Errorf("%s isn't a link", op)
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// The FICLONE ioctl from linux/fs.h, it makes the destination share the data of the source
+// on filesystems with copy on write like btrfs, xfs and bcachefs
+const ficlone = 0x40049409
+
+// Create dst as a copy of src that shares it's data until either is changed
+func reflink(src, dst string, perm os.FileMode) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	err = out.Close()
+	if errno != 0 {
+		os.Remove(dst)
+		// These mean the filesystem can't do it, or not between these two files
+		if errno == syscall.EOPNOTSUPP || errno == syscall.ENOTTY || errno == syscall.EXDEV ||
+			errno == syscall.EINVAL || errno == syscall.ENOSYS {
+			return fmt.Errorf("%w %w", errReflinkUnsupported, errno)
+		}
+		return errno
+	} else if err != nil {
+		os.Remove(dst)
+	}
+	return
+}
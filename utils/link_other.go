@@ -0,0 +1,9 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+func reflink(src, dst string, perm os.FileMode) error {
+	return errReflinkUnsupported
+}
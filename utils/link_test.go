@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinkFiles(t *testing.T) {
+	dir := t.TempDir()
+	keeper := filepath.Join(dir, "keeper.jpg")
+	if err := os.WriteFile(keeper, []byte("keeper"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	for name, op := range LinkModes {
+		file := filepath.Join(dir, name+".jpg")
+		if err := os.WriteFile(file, []byte("duplicate"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := LinkFiles([]string{file}, keeper, op); err != nil {
+			t.Fatalf("Unable to %s link %v", name, err)
+		}
+		if data, err := os.ReadFile(file); err != nil || string(data) != "keeper" {
+			t.Errorf("Expected the %s link to have the keeper's contents but got %s %v", name, data, err)
+		}
+		// Linking again should be a no-op for the same file
+		if op != Reflink {
+			if err := LinkFiles([]string{file}, keeper, op); err != nil {
+				t.Errorf("Expected linking an already %s linked file to do nothing %v", name, err)
+			}
+		}
+	}
+
+	if target, err := os.Readlink(filepath.Join(dir, "sym.jpg")); err != nil || target != keeper {
+		t.Errorf("Expected a symlink to %s but got %s %v", keeper, target, err)
+	}
+	keeperInfo, _ := os.Stat(keeper)
+	if info, err := os.Stat(filepath.Join(dir, "hard.jpg")); err != nil || !os.SameFile(info, keeperInfo) {
+		t.Errorf("Expected a hard link to the keeper %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != len(LinkModes)+1 {
+		t.Errorf("Expected no temporary files to be left behind but found %d files", len(entries))
+	}
+	if err := LinkFiles([]string{filepath.Join(dir, "missing.jpg")}, keeper, HardLink); err == nil {
+		t.Error("Expected linking a missing file to fail")
+	}
+}
+
+func TestReflinkAcrossFilesystems(t *testing.T) {
+	// Neither a reflink or the hard link it falls back to can be made from a tmpfs to anywhere else
+	dir, err := os.MkdirTemp("/dev/shm", "link-test")
+	if err != nil {
+		t.Skip("no /dev/shm to link across filesystems from")
+	}
+	defer os.RemoveAll(dir)
+	keeper := filepath.Join(dir, "keeper.jpg")
+	if err := os.WriteFile(keeper, []byte("keeper"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "duplicate.jpg")
+	if err := os.WriteFile(file, []byte("duplicate"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err = LinkFiles([]string{file}, keeper, Reflink)
+	if err == nil || !strings.Contains(err.Error(), "reflink") || !strings.Contains(err.Error(), "different filesystems") {
+		t.Errorf("Expected an error saying why the reflink can't be made but got %v", err)
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		t.Errorf("Expected the reflink error instead of the hard link error %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "duplicate" {
+		t.Error("Expected the file to be left alone")
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"time"
+)
+
+// What we can tell about an image file without decoding the whole thing
+type Metadata struct {
+	// The dimensions of the image as it's displayed, after any EXIF orientation
+	Width  int
+	Height int
+	// The image format as known to the image package, like jpeg or png
+	Format string
+	// The estimated quality a JPEG was saved at from 1 to 100, zero for anything else
+	Quality int
+	// These come from EXIF data and are left empty when it's missing
+	Taken       time.Time
+	Make        string
+	Model       string
+	Orientation int
+}
+
+// The headers and metadata of an image are at the start of the file and EXIF data is limited
+// to a 64KB segment in a JPEG, so only this much is read unless it isn't enough
+const metadataReadSize = 256 * 1024
+
+// Read the dimensions and any EXIF metadata of an image file
+func ReadMetadata(file string) (meta Metadata, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, metadataReadSize))
+	if err != nil {
+		return
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil && len(data) == metadataReadSize {
+		// Large embedded thumbnails or colour profiles can push the image header further in
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		config, format, err = image.DecodeConfig(f)
+	}
+	if err != nil {
+		return
+	}
+	meta.Width, meta.Height, meta.Format = config.Width, config.Height, format
+	meta.Orientation = OrientNormal
+	meta.Quality = JpegQuality(data)
+
+	exif, e := ParseExif(data)
+	if e != nil {
+		return
+	}
+	meta.Make = exif.Make()
+	meta.Model = exif.Model()
+	meta.Taken, _ = exif.DateTimeOriginal()
+	meta.Orientation = exif.Orientation()
+	// Images are hashed upright so report them that way too
+	if meta.Orientation >= OrientTranspose {
+		meta.Width, meta.Height = meta.Height, meta.Width
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"image"
+)
+
+// Orientations follow the numbering of the EXIF orientation tag, where each one is
+// how the stored image has to be transformed to display upright. Together they are every
+// combination of 90 degree rotations and mirroring.
+//
+//	1 as is                  5 mirrored across the top left to bottom right diagonal
+//	2 mirrored horizontally  6 rotated 90 degrees clockwise
+//	3 rotated 180 degrees    7 mirrored across the top right to bottom left diagonal
+//	4 mirrored vertically    8 rotated 90 degrees counter clockwise
+const (
+	OrientNormal = iota + 1
+	OrientFlipH
+	OrientRotate180
+	OrientFlipV
+	OrientTranspose
+	OrientRotate90
+	OrientTransverse
+	OrientRotate270
+)
+
+// Transform the image with one of the orientations above, anything unknown is left as is
+func Orient(img image.Image, orientation int) *image.NRGBA {
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if orientation < OrientFlipH || orientation > OrientRotate270 {
+		return src
+	}
+
+	dw, dh := w, h
+	if orientation >= OrientTranspose {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			// Find where each destination pixel comes from in the source
+			var sx, sy int
+			switch orientation {
+			case OrientFlipH:
+				sx, sy = w-1-x, y
+			case OrientRotate180:
+				sx, sy = w-1-x, h-1-y
+			case OrientFlipV:
+				sx, sy = x, h-1-y
+			case OrientTranspose:
+				sx, sy = y, x
+			case OrientRotate90:
+				sx, sy = y, h-1-x
+			case OrientTransverse:
+				sx, sy = w-1-y, h-1-x
+			case OrientRotate270:
+				sx, sy = w-1-y, x
+			}
+			i := dst.PixOffset(x, y)
+			j := src.PixOffset(sx, sy)
+			copy(dst.Pix[i:i+4], src.Pix[j:j+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with a unique grey value for each pixel
+	//	0 1 2
+	//	3 4 5
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := range 2 {
+		for x := range 3 {
+			src.Set(x, y, color.NRGBA{uint8(y*3 + x), 0, 0, 0xff})
+		}
+	}
+
+	testCases := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{OrientNormal, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{OrientFlipH, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{OrientRotate180, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{OrientFlipV, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{OrientTranspose, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{OrientRotate90, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{OrientTransverse, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{OrientRotate270, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, tc := range testCases {
+		got := Orient(src, tc.orientation)
+		if got.Rect.Dx() != len(tc.want[0]) || got.Rect.Dy() != len(tc.want) {
+			t.Errorf("Orientation %d has the wrong size %v", tc.orientation, got.Rect)
+			continue
+		}
+		for y, row := range tc.want {
+			for x, v := range row {
+				if got.NRGBAAt(x, y).R != v {
+					t.Errorf("Orientation %d at %d,%d got %d but expected %d", tc.orientation, x, y, got.NRGBAAt(x, y).R, v)
+				}
+			}
+		}
+	}
+}
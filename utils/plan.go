@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type Operation int
+
+const (
+	Delete Operation = iota
+	Move
+	Copy
+	Trash
+	HardLink
+	SymLink
+	Reflink
+)
+
+var Operations = map[string]Operation{
+	"delete":   Delete,
+	"move":     Move,
+	"copy":     Copy,
+	"trash":    Trash,
+	"hardlink": HardLink,
+	"symlink":  SymLink,
+	"reflink":  Reflink,
+}
+
+func (o Operation) String() string {
+	for name, op := range Operations {
+		if op == o {
+			return name
+		}
+	}
+	return fmt.Sprintf("Operation(%d)", int(o))
+}
+
+// Whether the operation changes or removes the original file, these are what an undo journal records
+func (o Operation) Destructive() bool {
+	return o != Copy
+}
+
+func (o Operation) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *Operation) UnmarshalText(text []byte) error {
+	op, ok := Operations[string(text)]
+	if !ok {
+		return fmt.Errorf("unknown operation %s", text)
+	}
+	*o = op
+	return nil
+}
+
+// A single change to a file. Dst is where the file ends up and is empty for a delete.
+// For the trash it's the trash directory, the file is given a unique name in it once it's trashed.
+// For links Src is replaced by a link to Dst.
+type Action struct {
+	Op  Operation `json:"op"`
+	Src string    `json:"src"`
+	Dst string    `json:"dst,omitempty"`
+	// Compare a copy against the original once it's made, when it's a real copy and not a hard link
+	Verify bool `json:"verify,omitempty"`
+}
+
+func (a Action) String() string {
+	if a.Dst == "" {
+		return fmt.Sprintf("%s %s", a.Op, a.Src)
+	}
+	return fmt.Sprintf("%s %s -> %s", a.Op, a.Src, a.Dst)
+}
+
+// Do the action, making any directories needed for the destination
+func (a Action) Run() error {
+	_, err := a.run()
+	return err
+}
+
+// Do the action and return where the file ended up
+func (a Action) run() (string, error) {
+	switch a.Op {
+	case Delete:
+		return "", os.Remove(a.Src)
+	case Trash:
+		return TrashFile(a.Src)
+	case HardLink, SymLink, Reflink:
+		return a.Dst, replaceWithLink(a.Src, a.Dst, a.Op)
+	case Move, Copy:
+		if err := os.MkdirAll(filepath.Dir(a.Dst), 0750); err != nil {
+			return "", err
+		}
+		if a.Op == Move {
+			// Renaming would replace anything there without a word
+			if _, err := os.Lstat(a.Dst); err == nil {
+				return "", fmt.Errorf("%s already exists", a.Dst)
+			}
+			return a.Dst, os.Rename(a.Src, a.Dst)
+		}
+		// A hard link should be sufficient, when there can't be one the file is copied instead
+		err := os.Link(a.Src, a.Dst)
+		if linkUnsupported(err) {
+			err = copyFile(a.Src, a.Dst, a.Verify)
+		}
+		return a.Dst, err
+	}
+	return "", fmt.Errorf("unknown operation %d", a.Op)
+}
+
+// A Plan is everything that will be done to the files, in order. Building one before touching
+// anything means it can be reviewed first and what's reviewed is exactly what runs.
+type Plan []Action
+
+// Run each action of the plan. Bubble up any errors without breaking the loop.
+func (p Plan) Run() error {
+	return p.run(nil)
+}
+
+// Run each action of the plan like Run and record every destructive action that's done to the
+// journal as it happens, so even an interrupted run can be undone. See Undo.
+func (p Plan) RunJournal(journal io.Writer) error {
+	return p.run(json.NewEncoder(journal))
+}
+
+func (p Plan) run(journal *json.Encoder) (err error) {
+	for _, a := range p {
+		entry := JournalEntry{Action: a}
+		if journal != nil && a.Op.Destructive() {
+			var e error
+			if entry.Checksum, e = Checksum(a.Src); e != nil {
+				// If it can't be read it can't be put back the way it was so leave it be
+				err = errors.Join(err, fmt.Errorf("unable to %s %w", a, e))
+				continue
+			}
+		}
+		dst, e := a.run()
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to %s %w", a, e))
+			continue
+		}
+		entry.Dst = dst
+		if entry.Checksum != "" {
+			if e := journal.Encode(entry); e != nil {
+				err = errors.Join(err, fmt.Errorf("unable to journal %s %w", a, e))
+			}
+		}
+	}
+	return
+}
+
+// Write each action on it's own line
+func (p Plan) Print(w io.Writer) error {
+	for _, a := range p {
+		if _, err := fmt.Fprintln(w, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Plan moving the files into the directory, see Destinations for where they go
+func PlanMove(files []string, dir string, layout Layout, root string) (Plan, error) {
+	return planPlace(Move, files, dir, layout, root)
+}
+
+// Plan copying the files into the directory, see Destinations for where they go
+func PlanCopy(files []string, dir string, layout Layout, root string) (Plan, error) {
+	return planPlace(Copy, files, dir, layout, root)
+}
+
+func planPlace(op Operation, files []string, dir string, layout Layout, root string) (p Plan, err error) {
+	dsts, err := Destinations(files, dir, layout, root)
+	if err != nil {
+		return
+	}
+	for i, src := range files {
+		p = append(p, Action{Op: op, Src: src, Dst: dsts[i]})
+	}
+	return
+}
+
+func PlanDelete(files []string) (p Plan) {
+	for _, src := range files {
+		p = append(p, Action{Op: Delete, Src: src})
+	}
+	return
+}
+
+// Plan moving the files to the trash, see TrashFile
+func PlanTrash(files []string) (p Plan, err error) {
+	for _, src := range files {
+		dir, e := TrashDir(src)
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("unable to find the trash for %s %w", src, e))
+			continue
+		}
+		p = append(p, Action{Op: Trash, Src: src, Dst: dir})
+	}
+	return
+}
+
+// Plan replacing the files with links to the target, see LinkModes
+func PlanLink(files []string, target string, op Operation) (p Plan) {
+	for _, src := range files {
+		p = append(p, Action{Op: op, Src: src, Dst: target})
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanRun(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg"), filepath.Join(dir, "c.jpg")
+	var plan Plan
+	plan = append(plan, Action{Op: Move, Src: a, Dst: filepath.Join(dir, "moved", "a.jpg")})
+	plan = append(plan, Action{Op: Copy, Src: b, Dst: filepath.Join(dir, "copied", "b.jpg")})
+	plan = append(plan, PlanDelete([]string{c})...)
+	if err := plan.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gone := range []string{a, c} {
+		if _, err := os.Stat(gone); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be gone", gone)
+		}
+	}
+	for _, kept := range []string{b, filepath.Join(dir, "moved", "a.jpg"), filepath.Join(dir, "copied", "b.jpg")} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("Expected %s to exist %v", kept, err)
+		}
+	}
+
+	// Running it again fails for every action but doesn't stop at the first
+	if err := plan.Run(); err == nil {
+		t.Error("Expected running the plan twice to fail")
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	plan := Plan{{Op: Move, Src: "a/b.jpg", Dst: "dups/b.jpg"}, {Op: Delete, Src: "c.jpg"}}
+	var buf bytes.Buffer
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0] != plan[0] || decoded[1] != plan[1] {
+		t.Errorf("Expected %v after decoding but got %v", plan, decoded)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"op": "move"`)) {
+		t.Errorf("Expected operations by name but got %s", buf.String())
+	}
+}
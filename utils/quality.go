@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// JPEG quality isn't stored anywhere but most encoders follow the IJG reference in scaling the
+// example quantization tables from the JPEG spec by the quality. Comparing the luminance table
+// of a file against the example gives back roughly the quality it was saved at, which is a good
+// hint at which of two copies has been through more lossy saves.
+
+// The example luminance table from Annex K of the spec
+var stdLuminance = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// Tables are stored in zigzag order, this maps each position to the table above
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Estimate the quality from 1 to 100 a JPEG was saved at from the raw bytes of the file,
+// zero if it isn't a JPEG or there's no luminance table
+func JpegQuality(data []byte) (quality int) {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return 0
+	}
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker != 0xdb {
+			return true
+		}
+		// A DQT segment can hold several tables, each a precision and id byte and 64 values
+		for len(segment) > 0 {
+			precision, id := segment[0]>>4, segment[0]&0x0f
+			size := 64
+			if precision == 1 {
+				size = 128
+			}
+			if len(segment) < 1+size {
+				return false
+			}
+			if id == 0 {
+				// Low qualities scale a lot of the table past what a byte holds and get clamped,
+				// those values no longer say anything about the scale so they are left out
+				var sum, std int
+				for i := range 64 {
+					v := int(segment[1+i])
+					if precision == 1 {
+						v = int(binary.BigEndian.Uint16(segment[1+2*i:]))
+					}
+					if v < 255 {
+						sum += v
+						std += stdLuminance[zigzag[i]]
+					}
+				}
+				if std > 0 {
+					quality = qualityFromScale(float64(sum) * 100 / float64(std))
+				} else {
+					quality = 1
+				}
+				return false
+			}
+			segment = segment[1+size:]
+		}
+		return true
+	})
+	return
+}
+
+// Reverse the IJG scaling where quality q scales the table by 5000/q below 50 and 200-2q above
+func qualityFromScale(scale float64) int {
+	var q float64
+	if scale <= 100 {
+		q = (200 - scale) / 2
+	} else {
+		q = 5000 / scale
+	}
+	return min(100, max(1, int(q+0.5)))
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestJpegQuality(t *testing.T) {
+	img, err := LoadImage("../testimages/cats/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, quality := range []int{1, 5, 10, 25, 50, 60, 75, 90, 95, 100} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		// Rounding the table values loses a little precision
+		if got := JpegQuality(buf.Bytes()); absint(got-quality) > 1 {
+			t.Errorf("Expected a quality around %d but got %d", quality, got)
+		}
+	}
+	if JpegQuality([]byte("not a jpeg")) != 0 {
+		t.Error("Anything that isn't a jpeg should have no quality")
+	}
+	if JpegQuality(nil) != 0 || JpegQuality(image.NewGray(image.Rect(0, 0, 1, 1)).Pix) != 0 {
+		t.Error("Empty data should have no quality")
+	}
+}
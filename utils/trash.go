@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trashing follows the freedesktop.org trash spec so files can be restored from a file manager.
+// https://specifications.freedesktop.org/trash-spec/latest/
+// A trash directory has the file itself under files/ and a .trashinfo file under info/ with
+// where it came from. Files go to the home trash if they are on the same filesystem,
+// otherwise to a trash at the top of their own filesystem since they can't be renamed across.
+
+var errNoTrash = errors.New("the trash isn't supported on this platform")
+
+var errNoHome = errors.New("unable to find the home trash, neither XDG_DATA_HOME or HOME are set")
+
+// The home trash, $XDG_DATA_HOME/Trash which is usually ~/.local/share/Trash
+func homeTrash() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); data != "" {
+		return filepath.Join(data, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return "", errNoHome
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Find the trash directory a file would go to along with the top directory of it's filesystem
+// when that isn't the home trash, which the paths in it's info files are relative to.
+// Nothing is made unless create is set, so a shared trash that this user doesn't have a
+// directory in yet is given as is even though it might turn out it can't be made.
+func findTrash(file string, create bool) (dir, top string, err error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return
+	}
+	// The file's directory could be a link to somewhere on another filesystem
+	parent, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return
+	}
+	dev, err := device(parent)
+	if err != nil {
+		return
+	}
+	home, err := homeTrash()
+	if err != nil {
+		return
+	}
+	// The home trash might not have been made yet so check what it would be made on
+	existing := home
+	for {
+		if _, e := os.Stat(existing); e == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if homeDev, e := device(existing); e == nil && homeDev == dev {
+		return home, "", nil
+	}
+
+	top, err = mountPoint(parent, dev)
+	if err != nil {
+		return
+	}
+	uid := strconv.Itoa(os.Getuid())
+	// An admin can make a shared $topdir/.Trash with the sticky bit set for everyone's trash,
+	// it's ignored if it's a link or isn't sticky since other users could mess with it
+	shared := filepath.Join(top, ".Trash")
+	if info, e := os.Lstat(shared); e == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir = filepath.Join(shared, uid)
+		if !create {
+			return
+		}
+		if e := os.MkdirAll(dir, 0700); e == nil {
+			return
+		}
+	}
+	return filepath.Join(top, ".Trash-"+uid), top, nil
+}
+
+// Walk up from a directory while it's parent is still on the same filesystem
+func mountPoint(dir string, dev uint64) (string, error) {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		parentDev, err := device(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
+
+// The trash directory a file would be moved to, see TrashFile. This doesn't make anything
+// so it's safe to use when planning.
+func TrashDir(file string) (string, error) {
+	dir, _, err := findTrash(file, false)
+	return dir, err
+}
+
+// Move a file to the trash and return where it ended up. The name is made unique within the
+// trash if there's already a file of the same name in it.
+func TrashFile(file string) (dst string, err error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return
+	}
+	dir, top, err := findTrash(abs, true)
+	if err != nil {
+		return
+	}
+	files, info := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	if err = os.MkdirAll(files, 0700); err != nil {
+		return
+	}
+	if err = os.MkdirAll(info, 0700); err != nil {
+		return
+	}
+
+	// Paths in the home trash are absolute, the others are relative to the top of their filesystem
+	path := abs
+	if top != "" {
+		if path, err = filepath.Rel(top, abs); err != nil {
+			return
+		}
+	}
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: filepath.ToSlash(path)}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+
+	ext := filepath.Ext(abs)
+	stem := strings.TrimSuffix(filepath.Base(abs), ext)
+	for i := 1; ; i++ {
+		name := stem + ext
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+		// Creating the info file first reserves the name, it's how the spec avoids two
+		// programs trashing to the same name at once
+		infoFile := filepath.Join(info, name+".trashinfo")
+		f, e := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(e) {
+			continue
+		} else if e != nil {
+			return "", e
+		}
+		_, e = f.WriteString(contents)
+		e = errors.Join(e, f.Close())
+		dst = filepath.Join(files, name)
+		if e == nil {
+			// A file left behind without it's info file still holds the name
+			if _, err := os.Lstat(dst); err == nil {
+				os.Remove(infoFile)
+				continue
+			}
+			e = os.Rename(abs, dst)
+		}
+		if e != nil {
+			os.Remove(infoFile)
+			return "", e
+		}
+		return dst, nil
+	}
+}
+
+// The info file of a file in the trash
+func trashInfo(trashed string) string {
+	dir := filepath.Dir(filepath.Dir(trashed))
+	return filepath.Join(dir, "info", filepath.Base(trashed)+".trashinfo")
+}
+
+// Bubble up any errors without breaking the loop
+func TrashFiles(files []string) error {
+	p, err := PlanTrash(files)
+	return errors.Join(err, p.Run())
+}
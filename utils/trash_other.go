@@ -0,0 +1,7 @@
+//go:build !unix
+
+package utils
+
+func device(path string) (uint64, error) {
+	return 0, errNoTrash
+}
@@ -0,0 +1,127 @@
+//go:build unix
+
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	trash := filepath.Join(data, "Trash")
+
+	dir := t.TempDir()
+	var files []string
+	for _, sub := range []string{"a", "b"} {
+		file := filepath.Join(dir, sub, "my photo.jpg")
+		os.MkdirAll(filepath.Dir(file), 0750)
+		if err := os.WriteFile(file, []byte(sub), 0640); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	plan, err := PlanTrash(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan[0].Dst != trash {
+		t.Fatalf("Expected to trash to %s but got %s", trash, plan[0].Dst)
+	}
+	if _, err := os.Stat(trash); !os.IsNotExist(err) {
+		t.Error("Planning shouldn't make the trash")
+	}
+	var journal bytes.Buffer
+	if err := plan.RunJournal(&journal); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second file has the same name so it's given a new one
+	for i, name := range []string{"my photo.jpg", "my photo.2.jpg"} {
+		if _, err := os.Stat(filepath.Join(trash, "files", name)); err != nil {
+			t.Errorf("Expected %s in the trash %v", name, err)
+		}
+		info, err := os.ReadFile(filepath.Join(trash, "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := "Path=" + strings.ReplaceAll(files[i], " ", "%20") + "\n"
+		if !strings.HasPrefix(string(info), "[Trash Info]\n") || !strings.Contains(string(info), path) ||
+			!strings.Contains(string(info), "DeletionDate=") {
+			t.Errorf("Unexpected trash info for %s\n%s", name, info)
+		}
+	}
+
+	entries, err := ReadJournal(&journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected %s to be restored %v", file, err)
+		}
+	}
+	if infos, _ := os.ReadDir(filepath.Join(trash, "info")); len(infos) != 0 {
+		t.Errorf("Expected the trash info to be removed on restoring but found %d", len(infos))
+	}
+}
+
+func TestTrashDirShared(t *testing.T) {
+	// This needs a filesystem other than the one the home trash is on that we can write to the top of
+	top := "/dev/shm"
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", home)
+	topDev, err := device(top)
+	if err != nil {
+		t.Skip("no /dev/shm to test a trash on another filesystem")
+	}
+	if homeDev, err := device(home); err != nil || homeDev == topDev {
+		t.Skip("/dev/shm is on the same filesystem as the home trash")
+	}
+	if mount, err := mountPoint(top, topDev); err != nil || mount != top {
+		t.Skip("/dev/shm isn't the top of it's filesystem")
+	}
+	shared := filepath.Join(top, ".Trash")
+	if err := os.Mkdir(shared, 0777|os.ModeSticky); err != nil {
+		t.Skip("unable to make a shared trash in /dev/shm", err)
+	}
+	defer os.RemoveAll(shared)
+	os.Chmod(shared, 0777|os.ModeSticky)
+
+	dir, err := os.MkdirTemp(top, "trash-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "image.jpg")
+	if err := os.WriteFile(file, []byte("image"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := TrashDir(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(shared, strconv.Itoa(os.Getuid())); trash != want {
+		t.Errorf("Expected the shared trash %s but got %s", want, trash)
+	}
+	if _, err := os.Stat(trash); !os.IsNotExist(err) {
+		t.Error("Finding the trash shouldn't make it")
+	}
+	dst, err := TrashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(trash, "files", "image.jpg"); dst != want {
+		t.Errorf("Expected the file to be trashed to %s but got %s", want, dst)
+	}
+}
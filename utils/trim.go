@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// Trim any uniform borders from the edges of the image, like the black bars of letterboxed video
+// or the padding around screenshots. Each edge is trimmed while the next row or column in is all
+// the same colour, within the tolerance for any channel. The tolerance goes from 0 to 255 and a
+// little bit helps with compression noise. An image that is entirely border is left as is.
+func TrimBorders(img image.Image, tolerance int) image.Image {
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+
+	// Check if the pixels along a line are the colour of the line's first pixel
+	uniform := func(x, y, dx, dy, n int) bool {
+		ref := src.NRGBAAt(x, y)
+		for range n {
+			if !similar(ref, src.NRGBAAt(x, y), tolerance) {
+				return false
+			}
+			x += dx
+			y += dy
+		}
+		return true
+	}
+
+	top, bottom, left, right := 0, h, 0, w
+	for top < bottom && uniform(left, top, 1, 0, right-left) {
+		top++
+	}
+	for bottom > top && uniform(left, bottom-1, 1, 0, right-left) {
+		bottom--
+	}
+	if top >= bottom {
+		return img
+	}
+	for left < right && uniform(left, top, 0, 1, bottom-top) {
+		left++
+	}
+	for right > left && uniform(right-1, top, 0, 1, bottom-top) {
+		right--
+	}
+	if left >= right {
+		return img
+	}
+	if top == 0 && bottom == h && left == 0 && right == w {
+		return img
+	}
+	return src.SubImage(image.Rect(left, top, right, bottom))
+}
+
+func similar(a, b color.NRGBA, tolerance int) bool {
+	return diff(a.R, b.R) <= tolerance && diff(a.G, b.G) <= tolerance &&
+		diff(a.B, b.B) <= tolerance && diff(a.A, b.A) <= tolerance
+}
+
+func diff(a, b uint8) int {
+	return max(int(a), int(b)) - min(int(a), int(b))
+}
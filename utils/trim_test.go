@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// Put the image in the middle of a solid colour background with the given padding on each side
+func pad(img image.Image, top, bottom, left, right int, c color.Color) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx()+left+right, b.Dy()+top+bottom))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(left, top, left+b.Dx(), top+b.Dy()), img, b.Min, draw.Src)
+	return dst
+}
+
+func TestTrimBorders(t *testing.T) {
+	img, err := LoadImage("../testimages/cats/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	if got := TrimBorders(img, 16).Bounds(); got.Dx() != b.Dx() || got.Dy() != b.Dy() {
+		t.Fatalf("The image without borders shouldn't be trimmed but got %v from %v", got, b)
+	}
+
+	testCases := []struct {
+		name                     string
+		top, bottom, left, right int
+		color                    color.Color
+	}{
+		{"letterbox", 80, 80, 0, 0, color.Black},
+		{"pillarbox", 0, 0, 120, 120, color.Black},
+		{"white padding", 30, 50, 20, 10, color.White},
+		{"uneven", 0, 100, 60, 0, color.NRGBA{40, 40, 40, 255}},
+	}
+	for _, tc := range testCases {
+		padded := pad(img, tc.top, tc.bottom, tc.left, tc.right, tc.color)
+		// Compression noise is the reason for the tolerance so add a little to the bars
+		for y := range padded.Rect.Dy() {
+			for x := range padded.Rect.Dx() {
+				if inner := image.Rect(tc.left, tc.top, tc.left+b.Dx(), tc.top+b.Dy()); image.Pt(x, y).In(inner) {
+					continue
+				}
+				c := padded.NRGBAAt(x, y)
+				c.R ^= uint8((x + y) % 4)
+				padded.SetNRGBA(x, y, c)
+			}
+		}
+		got := TrimBorders(padded, 8).Bounds()
+		want := image.Rect(tc.left, tc.top, tc.left+b.Dx(), tc.top+b.Dy())
+		if got != want {
+			t.Errorf("%s trimmed to %v but expected %v", tc.name, got, want)
+		}
+		if got := TrimBorders(padded, 0).Bounds(); got == want {
+			t.Errorf("%s shouldn't be trimmed with no tolerance for the noise", tc.name)
+		}
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 50, 50))
+	if got := TrimBorders(blank, 0).Bounds(); got != blank.Bounds() {
+		t.Errorf("A blank image should be left as is but got %v", got)
+	}
+}
@@ -0,0 +1,170 @@
+package vptree
+
+import (
+	"fmt"
+	"iter"
+	"math"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+// A Forest matches items on several hashes at once, each item carrying one set of hashes per
+// algorithm in Item.All. A tree is built for each algorithm with it's own metric since the
+// combinations can't generally be used as a metric themselves.
+//
+// Distances from a forest are a score relative to each algorithm's threshold, where each
+// algorithm's distance is divided by it's threshold and then combined. A score under 1 is
+// a match, so a search radius of 1 uses the thresholds as they are.
+
+type Combine int
+
+const (
+	// Every algorithm has to be within it's threshold, the score is the largest of them
+	All Combine = iota
+	// Any algorithm within it's threshold is enough, the score is the smallest of them
+	Any
+	// The weighted average of the scores has to be under 1. An algorithm can be past it's
+	// threshold as long as the others are close enough to make up for it.
+	Weighted
+)
+
+var Combines = map[string]Combine{
+	"all":      All,
+	"any":      Any,
+	"weighted": Weighted,
+}
+
+type Forest struct {
+	trees      []*VPTree
+	metrics    []Metric
+	thresholds []float64
+	weights    []float64
+	combine    Combine
+	items      []*Item
+}
+
+// Check there is a weight for each of the hashers and they are all positive. A weight of zero
+// or less would let a combined score slip under 1 without any of the hashes being close.
+func CheckWeights(weights []float64, hashers int) error {
+	if weights == nil {
+		return nil
+	}
+	if len(weights) != hashers {
+		return fmt.Errorf("%d weights were given for %d hashes", len(weights), hashers)
+	}
+	for _, w := range weights {
+		if w <= 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fmt.Errorf("invalid weight %v, weights have to be positive", w)
+		}
+	}
+	return nil
+}
+
+// Build a forest with a hasher for each set of hashes the items carry, which gives the metric
+// and threshold for them. The weights are only used by the Weighted combination and can be left
+// nil for equal weights, otherwise they are checked with CheckWeights.
+func NewForest(items []*Item, hashers []hash.Hasher, weights []float64, combine Combine) (*Forest, error) {
+	if err := CheckWeights(weights, len(hashers)); err != nil {
+		return nil, err
+	}
+	metrics := make([]Metric, len(hashers))
+	thresholds := make([]float64, len(hashers))
+	for i, h := range hashers {
+		metrics[i] = h.Distance
+		thresholds[i] = h.Threshold()
+	}
+	if weights == nil {
+		weights = make([]float64, len(metrics))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	f := &Forest{
+		metrics:    metrics,
+		thresholds: thresholds,
+		weights:    weights,
+		combine:    combine,
+		items:      items,
+	}
+	for i, h := range hashers {
+		// Each tree only looks at it's own set of hashes but keeps the full item around
+		// so the other algorithms can be checked on whatever it finds
+		treeItems := make([]*Item, len(items))
+		for j, item := range items {
+			treeItems[j] = &Item{ID: item.ID, Hashes: item.All[i], All: item.All}
+		}
+		f.trees = append(f.trees, NewForHasher(treeItems, h))
+	}
+	return f, nil
+}
+
+func (f *Forest) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		for _, item := range f.items {
+			if !yield(*item) {
+				return
+			}
+		}
+	}
+}
+
+// The combined score between two items
+func (f *Forest) score(a, b Item) float64 {
+	var score float64
+	var totalWeight float64
+	for i, metric := range f.metrics {
+		ratio := metric(a.All[i], b.All[i]) / f.thresholds[i]
+		switch f.combine {
+		case All:
+			score = max(score, ratio)
+		case Any:
+			if i == 0 {
+				score = ratio
+			}
+			score = min(score, ratio)
+		case Weighted:
+			score += ratio * f.weights[i]
+			totalWeight += f.weights[i]
+		}
+	}
+	if f.combine == Weighted {
+		score /= totalWeight
+	}
+	return score
+}
+
+// The combined score between two items, anything under 1 is a match
+func (f *Forest) Distance(a, b Item) float64 {
+	return f.score(a, b)
+}
+
+// Find the items with a combined score under the radius from the target
+func (f *Forest) Within(target Item, radius float64) ([]Item, []float64) {
+	// When everything has to match the first tree has every possible match so there is
+	// no need to query the rest. Otherwise a match has to be under the threshold of at least
+	// one algorithm, which holds for the weighted average too, so every tree is checked.
+	trees := f.trees
+	if f.combine == All {
+		trees = trees[:1]
+	}
+
+	seen := make(map[uint]bool)
+	var results []Item
+	var scores []float64
+	for i, tree := range trees {
+		query := Item{ID: target.ID, Hashes: target.All[i], All: target.All}
+		found, _ := tree.Within(query, f.thresholds[i]*radius)
+		for _, item := range found {
+			if seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+			if s := f.score(target, item); s < radius {
+				results = append(results, item)
+				scores = append(scores, s)
+			}
+		}
+	}
+	return results, scores
+}
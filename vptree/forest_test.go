@@ -0,0 +1,78 @@
+package vptree
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+func TestForestWithin(t *testing.T) {
+	// Two sets of hashes per item, both from 0-255 so the max hamming distance is 8
+	var items []*Item
+	for i := range 0xff {
+		all := [][]uint64{{uint64(i)}, {uint64(rand.Intn(0xff))}}
+		items = append(items, &Item{ID: uint(i + 1), Hashes: all[0], All: all})
+	}
+	thresholds := []float64{3, 4}
+	hashers := []hash.Hasher{hash.WithThreshold(hash.DCT, thresholds[0]), hash.WithThreshold(hash.DCT, thresholds[1])}
+	target := *items[rand.Intn(len(items))]
+
+	for name, combine := range Combines {
+		forest, err := NewForest(items, hashers, []float64{2, 1}, combine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var expected []uint
+		for _, item := range items {
+			if item.ID == target.ID {
+				continue
+			}
+			a := hash.HammingDistance(target.All[0], item.All[0]) / thresholds[0]
+			b := hash.HammingDistance(target.All[1], item.All[1]) / thresholds[1]
+			var match bool
+			switch combine {
+			case All:
+				match = a < 1 && b < 1
+			case Any:
+				match = a < 1 || b < 1
+			case Weighted:
+				match = (2*a+b)/3 < 1
+			}
+			if match {
+				expected = append(expected, item.ID)
+			}
+		}
+
+		found, scores := forest.Within(target, 1)
+		var ids []uint
+		for i, item := range found {
+			ids = append(ids, item.ID)
+			if scores[i] >= 1 {
+				t.Errorf("%s returned a score %f outside of the radius", name, scores[i])
+			}
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, expected) {
+			t.Errorf("%s found %v but expected %v", name, ids, expected)
+		}
+	}
+}
+
+func TestForestWeights(t *testing.T) {
+	hashers := []hash.Hasher{hash.DCT, hash.DHASH}
+	for _, weights := range [][]float64{{1}, {0, 0}, {2, -1}, {1, math.NaN()}} {
+		if _, err := NewForest(nil, hashers, weights, Weighted); err == nil {
+			t.Errorf("Weights %v should not be accepted", weights)
+		}
+	}
+	if _, err := NewForest(nil, hashers, []float64{2, 0.5}, Weighted); err != nil {
+		t.Errorf("Positive weights should be accepted %v", err)
+	}
+	if _, err := NewForest(nil, hashers, nil, Weighted); err != nil {
+		t.Errorf("No weights should be accepted as equal weights %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package vptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+// An Index is a built tree along with everything needed to query it from another process.
+// It is written in a small binary format so a large tree can be loaded without rebuilding it.
+//
+// The layout is little endian and goes
+//	magic "VPTI" | version uint16
+//	hasher name (uint16 length + bytes) | threshold float64
+//	trim bool | trim tolerance int32 | ignore exif orientation bool | any orientation bool | segments uint16
+//	file count uint32 | each path as uint32 length + bytes, in ID order
+//	orientation count uint8 | for each file in ID order that many of hash count uint16 | hashes uint64...
+//	nodes in preorder, each a marker byte (0 for an empty branch, 1 for a node) followed by
+//	the ID uint64 | hash count uint16 | hashes uint64... | node threshold float64
+//	and nothing after the root node
+
+type Index struct {
+	Tree    *VPTree
+	Files   *FileMapper
+	Hasher  hash.Hasher
+	Options IndexOptions
+	// The items for every orientation of each file indexed by ID when it was built to
+	// match images in any orientation, otherwise this is nil
+	Orientations [][]Item
+}
+
+// How the images were loaded before they were hashed into the index, anything compared against
+// it has to be hashed the same way. These match the options of the same name on a dedupe.Deduper.
+type IndexOptions struct {
+	TrimBorders           bool
+	TrimTolerance         int
+	IgnoreExifOrientation bool
+	AnyOrientation        bool
+	Segments              int
+}
+
+var magic = [4]byte{'V', 'P', 'T', 'I'}
+
+// Bump this for any change to the layout, older versions will fail to load
+const indexVersion uint16 = 3
+
+var ErrBadIndex = errors.New("not a valid index file")
+
+// No path or hasher name comes close to this, anything longer means the file is corrupt and
+// shouldn't be trusted with how much to allocate
+const maxStringLength = 1 << 16
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+// Any write error is sticky so the encoding doesn't need to check every field
+func (e *encoder) write(v any) {
+	if e.err != nil {
+		return
+	}
+	e.err = binary.Write(e.w, binary.LittleEndian, v)
+}
+
+func (e *encoder) writeString(s string, size int) {
+	if size == 2 {
+		e.write(uint16(len(s)))
+	} else {
+		e.write(uint32(len(s)))
+	}
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *encoder) writeNode(n *Node) {
+	if n == nil {
+		e.write(uint8(0))
+		return
+	}
+	e.write(uint8(1))
+	e.write(uint64(n.item.ID))
+	e.write(uint16(len(n.item.Hashes)))
+	e.write(n.item.Hashes)
+	e.write(n.threshold)
+	e.writeNode(n.left)
+	e.writeNode(n.right)
+}
+
+// Write the index to w
+func (idx *Index) Save(w io.Writer) error {
+	if len(idx.Files.files) > math.MaxUint32 {
+		return fmt.Errorf("too many files to save an index %d", len(idx.Files.files))
+	}
+	if idx.Options.AnyOrientation != (idx.Orientations != nil) {
+		return errors.New("an index matching any orientation has to have the orientations of every file")
+	}
+	if idx.Options.TrimTolerance < 0 || idx.Options.TrimTolerance > math.MaxInt32 || idx.Options.Segments < 0 || idx.Options.Segments > math.MaxUint16 {
+		return fmt.Errorf("unable to save index options %+v", idx.Options)
+	}
+	e := encoder{w: bufio.NewWriter(w)}
+	e.write(magic)
+	e.write(indexVersion)
+	e.writeString(idx.Hasher.Name(), 2)
+	e.write(idx.Hasher.Threshold())
+	e.write(idx.Options.TrimBorders)
+	e.write(int32(idx.Options.TrimTolerance))
+	e.write(idx.Options.IgnoreExifOrientation)
+	e.write(idx.Options.AnyOrientation)
+	e.write(uint16(idx.Options.Segments))
+	e.write(uint32(len(idx.Files.files)))
+	for _, f := range idx.Files.files {
+		e.writeString(f, 4)
+	}
+	// Every file has the same orientations so the count is only written once
+	count := 0
+	if idx.Orientations != nil && len(idx.Files.files) > 0 {
+		count = len(idx.Orientations[1])
+	}
+	e.write(uint8(count))
+	for id := 1; count > 0 && id <= len(idx.Files.files); id++ {
+		if id >= len(idx.Orientations) || len(idx.Orientations[id]) != count {
+			return fmt.Errorf("expected %d orientations of every file but %s doesn't have them", count, idx.Files.files[id-1])
+		}
+		for _, item := range idx.Orientations[id] {
+			e.write(uint16(len(item.Hashes)))
+			e.write(item.Hashes)
+		}
+	}
+	e.writeNode(idx.Tree.root)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+type decoder struct {
+	r     *bufio.Reader
+	err   error
+	files uint
+}
+
+func (d *decoder) read(v any) {
+	if d.err != nil {
+		return
+	}
+	d.err = binary.Read(d.r, binary.LittleEndian, v)
+}
+
+func (d *decoder) readString(size int) string {
+	var n uint32
+	if size == 2 {
+		var n16 uint16
+		d.read(&n16)
+		n = uint32(n16)
+	} else {
+		d.read(&n)
+	}
+	if d.err != nil {
+		return ""
+	}
+	if n > maxStringLength {
+		d.err = fmt.Errorf("%w string length %d is too long", ErrBadIndex, n)
+		return ""
+	}
+	buf := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, buf)
+	return string(buf)
+}
+
+func (d *decoder) readNode() *Node {
+	var marker uint8
+	d.read(&marker)
+	if d.err != nil || marker == 0 {
+		return nil
+	} else if marker != 1 {
+		d.err = fmt.Errorf("%w unexpected node marker %d", ErrBadIndex, marker)
+		return nil
+	}
+
+	var id uint64
+	var count uint16
+	n := &Node{}
+	d.read(&id)
+	d.read(&count)
+	if d.err != nil {
+		return nil
+	}
+	// IDs are 1-indexed into the file list so anything outside of that is corrupt
+	if id == 0 || id > uint64(d.files) {
+		d.err = fmt.Errorf("%w item id %d is outside of the file list", ErrBadIndex, id)
+		return nil
+	}
+	n.item = Item{ID: uint(id), Hashes: make([]uint64, count)}
+	d.read(n.item.Hashes)
+	d.read(&n.threshold)
+	n.left = d.readNode()
+	n.right = d.readNode()
+	return n
+}
+
+// Read an index previously written with Save. The hasher has to be registered with the
+// hash package but will use the threshold the index was saved with.
+func Load(r io.Reader) (*Index, error) {
+	d := decoder{r: bufio.NewReader(r)}
+	var m [4]byte
+	var version uint16
+	d.read(&m)
+	if d.err != nil || m != magic {
+		return nil, ErrBadIndex
+	}
+	d.read(&version)
+	if d.err == nil && version != indexVersion {
+		return nil, fmt.Errorf("%w unsupported version %d", ErrBadIndex, version)
+	}
+
+	idx := &Index{Files: &FileMapper{}, Tree: &VPTree{}}
+	name := d.readString(2)
+	var threshold float64
+	d.read(&threshold)
+	if d.err != nil {
+		return nil, d.err
+	}
+	hasher, ok := hash.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w unknown hasher %s", ErrBadIndex, name)
+	}
+	idx.Hasher = hash.WithThreshold(hasher, threshold)
+
+	var tolerance int32
+	var segments uint16
+	d.read(&idx.Options.TrimBorders)
+	d.read(&tolerance)
+	d.read(&idx.Options.IgnoreExifOrientation)
+	d.read(&idx.Options.AnyOrientation)
+	d.read(&segments)
+	idx.Options.TrimTolerance = int(tolerance)
+	idx.Options.Segments = int(segments)
+	if d.err == nil && tolerance < 0 {
+		return nil, fmt.Errorf("%w negative trim tolerance %d", ErrBadIndex, tolerance)
+	}
+	idx.Tree.metric = hasher.Distance
+	idx.Tree.linear = !hash.IsMetric(hasher)
+
+	var count uint32
+	d.read(&count)
+	for range count {
+		f := d.readString(4)
+		if d.err != nil {
+			break
+		}
+		idx.Files.addFile(f)
+	}
+	d.files = idx.Files.count
+
+	var orientations uint8
+	d.read(&orientations)
+	if d.err == nil && (orientations > 0) != idx.Options.AnyOrientation {
+		return nil, fmt.Errorf("%w %d orientations of each file don't match the options", ErrBadIndex, orientations)
+	}
+	if orientations > 0 && d.err == nil {
+		idx.Orientations = make([][]Item, d.files+1)
+		for id := uint(1); id <= d.files && d.err == nil; id++ {
+			idx.Orientations[id] = make([]Item, orientations)
+			for i := range idx.Orientations[id] {
+				var n uint16
+				d.read(&n)
+				idx.Orientations[id][i] = Item{ID: id, Hashes: make([]uint64, n)}
+				d.read(idx.Orientations[id][i].Hashes)
+			}
+		}
+	}
+	idx.Tree.root = d.readNode()
+	if d.err != nil {
+		return nil, d.err
+	}
+	// Anything left over means this isn't the index it looks like
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w unexpected data after the tree", ErrBadIndex)
+	}
+	return idx, nil
+}
@@ -0,0 +1,140 @@
+package vptree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+func TestIndexSaveLoad(t *testing.T) {
+	var fileMap FileMapper
+	var items []*Item
+	for i := range 100 {
+		items = append(items, NewItem(fmt.Sprintf("image%d.jpg", i), &fileMap, rand.Uint64()))
+	}
+	options := IndexOptions{TrimBorders: true, TrimTolerance: 24, IgnoreExifOrientation: true}
+	idx := Index{Tree: New(items), Files: &fileMap, Hasher: hash.WithThreshold(hash.DCT, 12), Options: options}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Hasher.Name() != hash.DCT.Name() || loaded.Hasher.Threshold() != 12 {
+		t.Error("The loaded index should keep the hasher and threshold")
+	}
+	if loaded.Options != options {
+		t.Errorf("The loaded index should keep the options it was built with but got %+v", loaded.Options)
+	}
+	if !slices.Equal(loaded.Files.files, fileMap.files) {
+		t.Error("The loaded index should have the same files in the same order")
+	}
+	var original, reloaded []Item
+	for item := range idx.Tree.All() {
+		original = append(original, item)
+	}
+	for item := range loaded.Tree.All() {
+		reloaded = append(reloaded, item)
+	}
+	if !slices.EqualFunc(original, reloaded, func(a, b Item) bool {
+		return a.ID == b.ID && slices.Equal(a.Hashes, b.Hashes)
+	}) {
+		t.Error("The loaded tree should have the same items in the same layout")
+	}
+
+	target := *items[rand.Intn(len(items))]
+	want, _ := idx.Tree.Within(target, 20)
+	got, _ := loaded.Tree.Within(target, 20)
+	if len(want) != len(got) {
+		t.Errorf("The loaded tree returned %d results but %d were expected", len(got), len(want))
+	}
+}
+
+func TestIndexOrientations(t *testing.T) {
+	var fileMap FileMapper
+	var items []*Item
+	orientations := [][]Item{nil}
+	for i := range 10 {
+		item := NewItem(fmt.Sprintf("image%d.jpg", i), &fileMap, rand.Uint64())
+		items = append(items, item)
+		orientations = append(orientations, []Item{*item, {ID: item.ID, Hashes: []uint64{rand.Uint64()}}})
+	}
+	idx := Index{
+		Tree:         New(items),
+		Files:        &fileMap,
+		Hasher:       hash.DCT,
+		Options:      IndexOptions{AnyOrientation: true},
+		Orientations: orientations,
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(loaded.Orientations, orientations, func(a, b []Item) bool {
+		return slices.EqualFunc(a, b, func(a, b Item) bool {
+			return a.ID == b.ID && slices.Equal(a.Hashes, b.Hashes)
+		})
+	}) {
+		t.Error("The loaded index should have the same orientations of each file")
+	}
+
+	// Without them the index is the same as ever
+	idx.Options.AnyOrientation = false
+	idx.Orientations = nil
+	buf.Reset()
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = Load(&buf); err != nil || loaded.Orientations != nil {
+		t.Errorf("Expected an index without orientations to load without them %v", err)
+	}
+}
+
+func TestIndexLoadInvalid(t *testing.T) {
+	if _, err := Load(bytes.NewReader([]byte("not an index"))); !errors.Is(err, ErrBadIndex) {
+		t.Error("Loading an invalid file should fail with ErrBadIndex")
+	}
+
+	// A file list claiming a path of nearly 4GiB shouldn't be allocated before it's found to be cut short
+	var buf bytes.Buffer
+	e := encoder{w: bufio.NewWriter(&buf)}
+	e.write(magic)
+	e.write(indexVersion)
+	e.writeString(hash.DCT.Name(), 2)
+	e.write(hash.DCT.Threshold())
+	e.write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0})
+	e.write(uint32(1))
+	e.write(uint32(math.MaxUint32))
+	e.w.Flush()
+	if _, err := Load(&buf); !errors.Is(err, ErrBadIndex) {
+		t.Errorf("Loading an index with a corrupt path length should fail with ErrBadIndex, got %v", err)
+	}
+
+	// Nothing should follow the tree
+	var fileMap FileMapper
+	idx := Index{Tree: New([]*Item{NewItem("image.jpg", &fileMap, 1)}), Files: &fileMap, Hasher: hash.DCT}
+	buf.Reset()
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte(0)
+	if _, err := Load(&buf); !errors.Is(err, ErrBadIndex) {
+		t.Errorf("Loading an index with data after the tree should fail with ErrBadIndex, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package vptree
+
+import (
+	"cmp"
+	"iter"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+// A MultiIndex searches hashes compared by their hamming distance, like hash.DCT, without
+// comparing the target against most of them. A tree can't prune much between distinct 64 bit
+// hashes so every query ends up close to a linear scan, which makes finding every duplicate
+// in a large library quadratic.
+//
+// Each hash is split into m chunks and the items are indexed by the value of each chunk. Two
+// hashes a distance of r apart can't differ by more than r/m bits in every chunk, so a match
+// has at least one chunk within r/m bits of the target's. Only the items in those buckets are
+// compared and with small enough chunks most of the buckets are empty.
+// https://www.cs.toronto.edu/~norouzi/research/papers/multi_index_hashing.pdf
+
+// Past this the bucket offsets for a chunk take up more memory than they are worth
+const maxChunkWidth = 22
+
+type chunk struct {
+	offset, width int
+	// The positions of the items sorted by the value of this chunk,
+	// those with a value of v are ids[starts[v]:starts[v+1]]
+	starts []uint32
+	ids    []uint32
+}
+
+type MultiIndex struct {
+	items []Item
+	// The hashes of every item one after another, most candidates are only looked at long
+	// enough to find they are too far away so they are kept close together
+	hashes []uint64
+	words  int
+	chunks []chunk
+}
+
+// The largest whole distance that is under the radius, like the tree Within only finds
+// anything closer than the radius
+func maxDistance(radius float64) int {
+	return int(math.Ceil(radius)) - 1
+}
+
+// The value of the bits from offset to offset+width across the hashes
+func chunkValue(hashes []uint64, offset, width int) uint64 {
+	word, shift := offset/64, offset%64
+	v := hashes[word] >> shift
+	if shift+width > 64 && word+1 < len(hashes) {
+		v |= hashes[word+1] << (64 - shift)
+	}
+	return v & (1<<width - 1)
+}
+
+// How many values are within e bits of any value of a chunk
+func probes(width, e int) float64 {
+	total, c := 0.0, 1.0
+	for k := 0; k <= min(e, width); k++ {
+		total += c
+		c = c * float64(width-k) / float64(k+1)
+	}
+	return total
+}
+
+// Pick how many chunks to split the hashes into for a search radius. Fewer wider chunks mean
+// more values to look up for each chunk but fewer items in each bucket, this picks whichever
+// has the least lookups and comparisons for each query.
+func chunkCount(size, hashBits, distance int) int {
+	best, bestCost := hashBits, math.Inf(1)
+	for m := 1; m <= hashBits; m++ {
+		width := (hashBits + m - 1) / m
+		if width > maxChunkWidth {
+			continue
+		}
+		buckets := math.Exp2(float64(width))
+		p := probes(width, distance/m)
+		// Looking up each value, comparing what's in the buckets and the share of building the buckets
+		cost := float64(m) * (p + p*float64(size)/buckets + buckets/float64(max(1, size)))
+		if cost < bestCost {
+			best, bestCost = m, cost
+		}
+	}
+	return best
+}
+
+// Build an index of the items for searches up to the radius. Any radius can still be searched
+// but the chunks are sized for this one. Every item should have the same number of hashes.
+func NewMultiIndex(items []*Item, radius float64) *MultiIndex {
+	idx := &MultiIndex{items: make([]Item, len(items))}
+	if len(items) == 0 {
+		return idx
+	}
+	idx.words = len(items[0].Hashes)
+	idx.hashes = make([]uint64, 0, len(items)*idx.words)
+	for i, item := range items {
+		idx.items[i] = *item
+		idx.hashes = append(idx.hashes, item.Hashes...)
+	}
+
+	hashBits := 64 * idx.words
+	m := chunkCount(len(items), hashBits, max(0, maxDistance(radius)))
+	offset := 0
+	for i := range m {
+		// The leftover bits are spread over the first chunks
+		width := hashBits / m
+		if i < hashBits%m {
+			width++
+		}
+		c := chunk{offset: offset, width: width, starts: make([]uint32, 1<<width+1), ids: make([]uint32, len(items))}
+		offset += width
+
+		// A counting sort by the chunk value
+		for _, item := range idx.items {
+			c.starts[chunkValue(item.Hashes, c.offset, c.width)+1]++
+		}
+		for v := 1; v < len(c.starts); v++ {
+			c.starts[v] += c.starts[v-1]
+		}
+		next := slices.Clone(c.starts[:len(c.starts)-1])
+		for i, item := range idx.items {
+			v := chunkValue(item.Hashes, c.offset, c.width)
+			c.ids[next[v]] = uint32(i)
+			next[v]++
+		}
+		idx.chunks = append(idx.chunks, c)
+	}
+	return idx
+}
+
+// Every value with at most e of the lowest width bits set, including zero
+func flips(width, e int) []uint64 {
+	masks := []uint64{0}
+	var add func(mask uint64, from, left int)
+	add = func(mask uint64, from, left int) {
+		if left == 0 {
+			return
+		}
+		for b := from; b < width; b++ {
+			next := mask | 1<<b
+			masks = append(masks, next)
+			add(next, b+1, left-1)
+		}
+	}
+	add(0, 0, e)
+	return masks
+}
+
+func (idx *MultiIndex) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		for _, item := range idx.items {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// How far apart two items are by the hamming distance of their hashes
+func (idx *MultiIndex) Distance(a, b Item) float64 {
+	return hash.HammingDistance(a.Hashes, b.Hashes)
+}
+
+// Find the items closer than the radius to the target, sorted from closest to farthest.
+// Like the tree the target itself isn't included.
+func (idx *MultiIndex) Within(target Item, radius float64) ([]Item, []float64) {
+	distance := maxDistance(radius)
+	if distance < 0 || len(idx.chunks) == 0 {
+		return nil, nil
+	}
+	e := distance / len(idx.chunks)
+	values := make([]uint64, len(idx.chunks))
+	for i, c := range idx.chunks {
+		values[i] = chunkValue(target.Hashes, c.offset, c.width)
+	}
+	// An item close enough in an earlier chunk was already found from that one
+	foundBefore := func(hashes []uint64, before int) bool {
+		for j, c := range idx.chunks[:before] {
+			if bits.OnesCount64(chunkValue(hashes, c.offset, c.width)^values[j]) <= e {
+				return true
+			}
+		}
+		return false
+	}
+
+	type result struct {
+		item     Item
+		distance float64
+	}
+	var results []result
+	masks := make(map[int][]uint64)
+	for i, c := range idx.chunks {
+		if _, ok := masks[c.width]; !ok {
+			masks[c.width] = flips(c.width, e)
+		}
+		for _, mask := range masks[c.width] {
+			v := values[i] ^ mask
+			for _, pos := range c.ids[c.starts[v]:c.starts[v+1]] {
+				hashes := idx.hashes[int(pos)*idx.words : int(pos+1)*idx.words]
+				d := 0
+				for w, h := range hashes {
+					d += bits.OnesCount64(h ^ target.Hashes[w])
+				}
+				if float64(d) >= radius || foundBefore(hashes, i) {
+					continue
+				}
+				if item := idx.items[pos]; item.ID != target.ID {
+					results = append(results, result{item, float64(d)})
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(results, func(a, b result) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.item.ID, b.item.ID))
+	})
+	items := make([]Item, len(results))
+	distances := make([]float64, len(results))
+	for i, r := range results {
+		items[i] = r.item
+		distances[i] = r.distance
+	}
+	return items, distances
+}
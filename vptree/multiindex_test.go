@@ -0,0 +1,70 @@
+package vptree
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+func TestMultiIndexWithin(t *testing.T) {
+	for _, words := range []int{1, 2} {
+		// Near copies of a few hashes so there is something to find at every distance
+		var items []*Item
+		var bases [][]uint64
+		for range 50 {
+			base := make([]uint64, words)
+			for w := range base {
+				base[w] = rand.Uint64()
+			}
+			bases = append(bases, base)
+		}
+		for i := range 2000 {
+			h := slices.Clone(bases[rand.Intn(len(bases))])
+			for range rand.Intn(12) {
+				h[rand.Intn(words)] ^= 1 << rand.Intn(64)
+			}
+			items = append(items, &Item{ID: uint(i + 1), Hashes: h})
+		}
+
+		for _, radius := range []float64{0, 1, 4, 10, 10.5, 22} {
+			idx := NewMultiIndex(items, radius)
+			for range 20 {
+				target := *items[rand.Intn(len(items))]
+				var expected []uint
+				for _, item := range items {
+					if item.ID != target.ID && hash.HammingDistance(target.Hashes, item.Hashes) < radius {
+						expected = append(expected, item.ID)
+					}
+				}
+				found, distances := idx.Within(target, radius)
+				var ids []uint
+				for i, f := range found {
+					ids = append(ids, f.ID)
+					if i > 0 && distances[i] < distances[i-1] {
+						t.Error("Within should be sorted from closest to farthest")
+					}
+				}
+				slices.Sort(ids)
+				if !slices.Equal(ids, expected) {
+					t.Fatalf("%d words within %v found %d but expected %d", words, radius, len(ids), len(expected))
+				}
+			}
+		}
+	}
+}
+
+func TestMultiIndexRadius(t *testing.T) {
+	// Chunks sized for one radius still find everything for a wider one
+	var items []*Item
+	for i := range 500 {
+		items = append(items, &Item{ID: uint(i + 1), Hashes: []uint64{uint64(rand.Intn(0xffff))}})
+	}
+	target := *items[0]
+	found, _ := NewMultiIndex(items, 2).Within(target, 6)
+	want, _ := New(items).Within(target, 6)
+	if len(found) != len(want) {
+		t.Errorf("Found %d but the tree found %d", len(found), len(want))
+	}
+}
@@ -0,0 +1,139 @@
+package vptree
+
+import (
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+// A RegionTree searches images that have a hash for each region of them, like the segments from
+// hash.Segmented. Each region is it's own item in the tree and two images match when enough
+// of their regions are within the radius of each other.
+//
+// The items of a RegionTree pack the hashes of their regions into Item.Hashes with
+// hash.PackRegions so they can be grouped and searched like any other items.
+
+type RegionTree struct {
+	tree *VPTree
+	// The image ID for each region by the region's ID, the first slot is empty since IDs are 1-indexed
+	owners  []uint
+	items   map[uint]*Item
+	matches int
+}
+
+// Create an item with a hash for each region of an image
+func NewRegionItem(file string, fileMap *FileMapper, regions [][]uint64) *Item {
+	return NewItem(file, fileMap, hash.PackRegions(regions)...)
+}
+
+// Build a tree of every region of the items. The hasher's distance compares two region hashes
+// and matches is how many regions of an image have to match another for it to be found.
+func NewRegionTree(items []*Item, hasher hash.Hasher, matches int) *RegionTree {
+	r := &RegionTree{owners: []uint{0}, items: make(map[uint]*Item, len(items)), matches: max(1, matches)}
+	var regions []*Item
+	for _, item := range items {
+		r.items[item.ID] = item
+		for _, region := range hash.UnpackRegions(item.Hashes) {
+			r.owners = append(r.owners, item.ID)
+			regions = append(regions, &Item{ID: uint(len(r.owners) - 1), Hashes: region})
+		}
+	}
+	r.tree = NewForHasher(regions, hasher)
+	return r
+}
+
+func (r *RegionTree) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		ids := slices.Sorted(func(yield func(uint) bool) {
+			for id := range r.items {
+				if !yield(id) {
+					return
+				}
+			}
+		})
+		for _, id := range ids {
+			if !yield(*r.items[id]) {
+				return
+			}
+		}
+	}
+}
+
+// The distance from each region of a to the closest region of b, sorted from closest to farthest
+func (r *RegionTree) closest(a, b [][]uint64) []float64 {
+	var closest []float64
+	for _, region := range a {
+		nearest := math.Inf(1)
+		for _, other := range b {
+			nearest = min(nearest, r.tree.metric(region, other))
+		}
+		closest = append(closest, nearest)
+	}
+	slices.Sort(closest)
+	return closest
+}
+
+// How far apart two items are. From each side it's the average distance of the closest regions
+// to any region of the other, for as many regions as have to match, and it's the farther of
+// the two sides so it's the same whichever way round they are given.
+func (r *RegionTree) Distance(a, b Item) float64 {
+	regionsA, regionsB := hash.UnpackRegions(a.Hashes), hash.UnpackRegions(b.Hashes)
+	if len(regionsA) == 0 || len(regionsB) == 0 {
+		return math.Inf(1)
+	}
+	average := func(closest []float64) float64 {
+		closest = closest[:min(r.matches, len(closest))]
+		var total float64
+		for _, d := range closest {
+			total += d
+		}
+		return total / float64(len(closest))
+	}
+	return max(average(r.closest(regionsA, regionsB)), average(r.closest(regionsB, regionsA)))
+}
+
+// Find the items with enough regions within the radius of the target's regions. Regions are
+// counted on both sides, so several regions of the target matching a single region of another
+// image only count once and a is found from b whenever b is found from a.
+// The distance for each is the same as Distance.
+func (r *RegionTree) Within(target Item, radius float64) ([]Item, []float64) {
+	regions := hash.UnpackRegions(target.Hashes)
+	counts := make(map[uint]int)
+	for _, region := range regions {
+		// A zero ID is never excluded, the target's own regions are skipped by their owner instead
+		found, _ := r.tree.Within(Item{Hashes: region}, radius)
+		// Each region of the target only counts once towards another image
+		// even if it matches several of it's regions
+		owners := make(map[uint]bool)
+		for _, f := range found {
+			if owner := r.owners[f.ID]; owner != target.ID {
+				owners[owner] = true
+			}
+		}
+		for owner := range owners {
+			counts[owner]++
+		}
+	}
+
+	var ids []uint
+	for id, count := range counts {
+		if count < r.matches {
+			continue
+		}
+		// Then the other way round, how many of it's regions are close to one of the target's
+		others := r.closest(hash.UnpackRegions(r.items[id].Hashes), regions)
+		if n, _ := slices.BinarySearch(others, radius); n >= r.matches {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	results := make([]Item, len(ids))
+	distances := make([]float64, len(ids))
+	for i, id := range ids {
+		results[i] = *r.items[id]
+		distances[i] = r.Distance(target, results[i])
+	}
+	return results, distances
+}
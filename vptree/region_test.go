@@ -0,0 +1,70 @@
+package vptree
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/alexgQQ/dedupe/hash"
+)
+
+func TestRegionTreeWithin(t *testing.T) {
+	var fileMap FileMapper
+	// a shares two regions with b and one with c, d shares nothing
+	a := NewRegionItem("a.jpg", &fileMap, [][]uint64{{0x0f}, {0xf0f0}, {0xff0000}})
+	b := NewRegionItem("b.jpg", &fileMap, [][]uint64{{0x0f}, {0xf0f1}, {0xffffffff00000000}})
+	c := NewRegionItem("c.jpg", &fileMap, [][]uint64{{0xff0001}, {0xffff0000ffff0000}})
+	d := NewRegionItem("d.jpg", &fileMap, [][]uint64{{0xaaaaaaaaaaaaaaaa}})
+	items := []*Item{a, b, c, d}
+
+	for matches, want := range map[int][]uint{1: {b.ID, c.ID}, 2: {b.ID}, 3: nil} {
+		tree := NewRegionTree(items, hash.DCT, matches)
+		found, distances := tree.Within(*a, 3)
+		var ids []uint
+		for _, f := range found {
+			ids = append(ids, f.ID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("With %d matches needed found %v but expected %v", matches, ids, want)
+		}
+		for _, dist := range distances {
+			if dist >= 3 {
+				t.Errorf("Found a distance %f outside of the radius", dist)
+			}
+		}
+	}
+
+	// The closest two regions of a are the ones that matched b
+	if dist := NewRegionTree(items, hash.DCT, 2).Distance(*a, *b); dist != 0.5 {
+		t.Errorf("Expected a distance of 0.5 between a and b but got %f", dist)
+	}
+
+	var all []string
+	for item := range NewRegionTree(items, hash.DCT, 1).All() {
+		all = append(all, fmt.Sprintf("%s %d", fileMap.ByID(item.ID), len(hash.UnpackRegions(item.Hashes))))
+	}
+	if !slices.Equal(all, []string{"a.jpg 3", "b.jpg 3", "c.jpg 2", "d.jpg 1"}) {
+		t.Errorf("Every image should be walked once with all of it's regions but got %v", all)
+	}
+}
+
+func TestRegionTreeWithinSymmetric(t *testing.T) {
+	var fileMap FileMapper
+	// Every region of a is close to the one region of b that isn't noise, which is only
+	// a single match from b's side so neither should find the other when two are needed
+	a := NewRegionItem("a.jpg", &fileMap, [][]uint64{{0x0f}, {0x0f}, {0x0e}})
+	b := NewRegionItem("b.jpg", &fileMap, [][]uint64{{0x0f}, {0xffffffff00000000}})
+	items := []*Item{a, b}
+
+	for matches, want := range map[int]bool{1: true, 2: false} {
+		tree := NewRegionTree(items, hash.DCT, matches)
+		fromA, _ := tree.Within(*a, 3)
+		fromB, _ := tree.Within(*b, 3)
+		if (len(fromA) > 0) != want || (len(fromB) > 0) != want {
+			t.Errorf("With %d matches needed a found %d and b found %d but they should match %v", matches, len(fromA), len(fromB), want)
+		}
+		if d := tree.Distance(*a, *b); d != tree.Distance(*b, *a) {
+			t.Errorf("The distance should be the same both ways but got %f and %f", d, tree.Distance(*b, *a))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package vptree
 import (
 	"container/heap"
 	"iter"
+	"math"
 	"math/rand"
 	"sync"
 
@@ -27,6 +28,13 @@ func (c *FileMapper) addFile(file string) uint {
 	return c.count
 }
 
+// The number of files mapped, which is also the largest ID
+func (c *FileMapper) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.files)
+}
+
 func (c *FileMapper) ByID(id uint) string {
 	// A panic may be more appropriate if the id is off then something is very wrong
 	// if int(id) > len(c.files) {
@@ -38,10 +46,13 @@ func (c *FileMapper) ByID(id uint) string {
 // 	Each Item represents a hash for an image file.
 //	An unique ID is used in place of the file path and should be 1-indexed to avoid zero valued collisions.
 // 	The hash is either a single 64 bit value (dct) or a 128 bit value (dhash) as two 64 bit values.
+//	When matching on several hashing algorithms at once, All holds a set of hashes for each
+//	algorithm and the per algorithm thresholds live with the Forest built from them.
 
 type Item struct {
 	ID     uint
 	Hashes []uint64
+	All    [][]uint64
 }
 
 func NewItem(file string, fileMap *FileMapper, hashes ...uint64) *Item {
@@ -50,6 +61,16 @@ func NewItem(file string, fileMap *FileMapper, hashes ...uint64) *Item {
 	return &item
 }
 
+// Create an item with a set of hashes for each algorithm, for use in a Forest
+func NewMultiItem(file string, fileMap *FileMapper, hashes [][]uint64) *Item {
+	item := Item{All: hashes}
+	if len(hashes) > 0 {
+		item.Hashes = hashes[0]
+	}
+	item.ID = fileMap.addFile(file)
+	return &item
+}
+
 type Node struct {
 	item      Item
 	threshold float64
@@ -57,27 +78,57 @@ type Node struct {
 	right     *Node
 }
 
-func distance(a, b Item) float64 {
-	if len(a.Hashes) != len(b.Hashes) {
-		panic("The hash sizes must be the same")
-	}
-	var dist int
-	for i, h := range a.Hashes {
-		dist += hash.Hamming(h, b.Hashes[i])
-	}
-	return float64(dist)
-}
+// How far apart two hashes are, this needs to follow the rules of a metric space
+// (zero for the same hash, symmetric and holding to the triangle inequality) for the
+// tree to prune correctly
+type Metric func(a, b []uint64) float64
 
 type VPTree struct {
-	root *Node
+	root   *Node
+	metric Metric
+	// Search every branch rather than pruning, for a metric that doesn't hold to the triangle inequality
+	linear bool
 }
 
+// Build a tree comparing items by their hamming distance
 func New(items []*Item) *VPTree {
-	t := &VPTree{}
+	return NewWithMetric(items, hash.HammingDistance)
+}
+
+// Build a tree comparing items by the given metric, usually the Distance of a hash.Hasher
+func NewWithMetric(items []*Item, metric Metric) *VPTree {
+	t := &VPTree{metric: metric}
 	t.root = t.build(items)
 	return t
 }
 
+// Build a tree that compares the target against every item when searching instead of pruning
+// branches. This is much slower for large sets but is the only way to not miss matches with a
+// metric that doesn't hold to the triangle inequality.
+func NewLinear(items []*Item, metric Metric) *VPTree {
+	t := NewWithMetric(items, metric)
+	t.linear = true
+	return t
+}
+
+// Build a tree comparing items by the hasher's distance, which is searched linearly
+// if it isn't a true metric, see hash.IsMetric
+func NewForHasher(items []*Item, h hash.Hasher) *VPTree {
+	if !hash.IsMetric(h) {
+		return NewLinear(items, h.Distance)
+	}
+	return NewWithMetric(items, h.Distance)
+}
+
+func (vp *VPTree) distance(a, b Item) float64 {
+	return vp.metric(a.Hashes, b.Hashes)
+}
+
+// How far apart two items are by the tree's metric
+func (vp *VPTree) Distance(a, b Item) float64 {
+	return vp.distance(a, b)
+}
+
 func (n *Node) walk(yield func(Item) bool) bool {
 	if n == nil {
 		return true
@@ -136,12 +187,12 @@ func (vp *VPTree) build(items []*Item) *Node {
 
 	if len(items) > 0 {
 		median := len(items) / 2
-		pivotDist := distance(*items[median], n.item)
+		pivotDist := vp.distance(*items[median], n.item)
 		items[median], items[len(items)-1] = items[len(items)-1], items[median]
 
 		storeIndex := 0
 		for i := 0; i < len(items)-1; i++ {
-			if distance(*items[i], n.item) <= pivotDist {
+			if vp.distance(*items[i], n.item) <= pivotDist {
 				items[storeIndex], items[i] = items[i], items[storeIndex]
 				storeIndex++
 			}
@@ -162,7 +213,7 @@ func (vp *VPTree) within(n *Node, tau float64, target Item, q *queue) {
 		return
 	}
 
-	dist := distance(n.item, target)
+	dist := vp.distance(n.item, target)
 
 	if dist < tau {
 		heap.Push(q, &QueueItem{n.item, dist})
@@ -173,85 +224,90 @@ func (vp *VPTree) within(n *Node, tau float64, target Item, q *queue) {
 	}
 
 	if dist < n.threshold {
-		if dist-tau <= n.threshold {
+		if vp.linear || dist-tau <= n.threshold {
 			vp.within(n.left, tau, target, q)
 		}
 
-		if dist+tau >= n.threshold {
+		if vp.linear || dist+tau >= n.threshold {
 			vp.within(n.right, tau, target, q)
 		}
 	} else {
-		if dist+tau >= n.threshold {
+		if vp.linear || dist+tau >= n.threshold {
 			vp.within(n.right, tau, target, q)
 		}
 
-		if dist-tau <= n.threshold {
+		if vp.linear || dist-tau <= n.threshold {
 			vp.within(n.left, tau, target, q)
 		}
 	}
 }
 
-// I don't actually need this functionality but it is a good example
-// for using this as a k item search
-// func (vp *VPTree) Search(target Item, k int) ([]Item, []float64) {
-// 	var results []Item
-// 	var distances []float64
-
-// 	q := make(queue, 0, k)
-
-// 	tau := math.MaxFloat64
-// 	vp.search(vp.root, tau, target, k, &q)
-
-// 	for q.Len() > 0 {
-// 		hi := heap.Pop(&q)
-// 		results = append(results, hi.(*QueueItem).Item)
-// 		distances = append(distances, hi.(*QueueItem).Dist)
-// 	}
-
-// 	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
-// 		results[i], results[j] = results[j], results[i]
-// 		distances[i], distances[j] = distances[j], distances[i]
-// 	}
-// 	return results, distances
-// }
-
-// func (vp *VPTree) search(n *Node, tau float64, target Item, k int, q *queue) {
-// 	// This comes through as nil when we've reached the end of a branch
-// 	if n == nil {
-// 		return
-// 	}
-
-// 	dist := distance(n.Item, target)
-
-// 	if dist < tau {
-// 		if q.Len() == k {
-// 			heap.Pop(q)
-// 		}
-// 		heap.Push(q, &QueueItem{n.Item, dist})
-// 		if q.Len() == k {
-// 			tau = q.Top().(*QueueItem).Dist
-// 		}
-// 	}
-
-// 	if n.Left == nil && n.Right == nil {
-// 		return
-// 	}
-
-// 	if dist < n.Threshold {
-// 		if dist-tau <= n.Threshold {
-// 			vp.search(n.Left, tau, target, k, q)
-// 		}
-
-// 		if dist+tau >= n.Threshold {
-// 			vp.search(n.Right, tau, target, k, q)
-// 		}
-// 	} else {
-// 		if dist+tau >= n.Threshold {
-// 			vp.search(n.Right, tau, target, k, q)
-// 		}
-
-// 		if dist-tau <= n.Threshold {
-// 			vp.search(n.Left, tau, target, k, q)
-// 		}
-// 	}
-// }
+// Find the k closest items to the target, sorted by distance from closest to farthest
+func (vp *VPTree) Search(target Item, k int) ([]Item, []float64) {
+	var results []Item
+	var distances []float64
+	if k <= 0 {
+		return results, distances
+	}
+
+	q := make(queue, 0, k)
+
+	tau := math.MaxFloat64
+	vp.search(vp.root, &tau, target, k, &q)
+
+	for q.Len() > 0 {
+		hi := heap.Pop(&q)
+		results = append(results, hi.(*QueueItem).item)
+		distances = append(distances, hi.(*QueueItem).dist)
+	}
+
+	// The queue pops the farthest first so flip them around
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+		distances[i], distances[j] = distances[j], distances[i]
+	}
+	return results, distances
+}
+
+// The search radius tau shrinks as closer items are found and needs to be
+// shared across the whole traversal, hence the pointer
+func (vp *VPTree) search(n *Node, tau *float64, target Item, k int, q *queue) {
+	// This comes through as nil when we've reached the end of a branch
+	if n == nil {
+		return
+	}
+
+	dist := vp.distance(n.item, target)
+
+	if dist < *tau && n.item.ID != target.ID {
+		if q.Len() == k {
+			heap.Pop(q)
+		}
+		heap.Push(q, &QueueItem{n.item, dist})
+		if q.Len() == k {
+			*tau = q.Top().(*QueueItem).dist
+		}
+	}
+
+	if n.left == nil && n.right == nil {
+		return
+	}
+
+	if dist < n.threshold {
+		if vp.linear || dist-*tau <= n.threshold {
+			vp.search(n.left, tau, target, k, q)
+		}
+
+		if vp.linear || dist+*tau >= n.threshold {
+			vp.search(n.right, tau, target, k, q)
+		}
+	} else {
+		if vp.linear || dist+*tau >= n.threshold {
+			vp.search(n.right, tau, target, k, q)
+		}
+
+		if vp.linear || dist-*tau <= n.threshold {
+			vp.search(n.left, tau, target, k, q)
+		}
+	}
+}
@@ -53,3 +53,70 @@ func TestVPTreeWithin(t *testing.T) {
 		}
 	}
 }
+
+func TestVPTreeSearch(t *testing.T) {
+	var samples []*Item
+	for i := range 500 {
+		item := Item{ID: uint(i + 1), Hashes: []uint64{rand.Uint64()}}
+		samples = append(samples, &item)
+	}
+	target := Item{Hashes: []uint64{rand.Uint64()}}
+
+	// Brute force the k closest distances to check against
+	k := 5
+	var expected []float64
+	for _, item := range samples {
+		expected = append(expected, float64(hash.Hamming(target.Hashes[0], item.Hashes[0])))
+	}
+	slices.Sort(expected)
+	expected = expected[:k]
+
+	tree := New(samples)
+	found, distances := tree.Search(target, k)
+	if len(found) != k {
+		t.Fatalf("Search returned %d results but %d were expected", len(found), k)
+	}
+	if !slices.Equal(distances, expected) {
+		t.Errorf("Search returned distances %v but expected %v", distances, expected)
+	}
+	for i, result := range found {
+		if float64(hash.Hamming(target.Hashes[0], result.Hashes[0])) != distances[i] {
+			t.Error("Search returned an item with an unexpected hamming distance")
+		}
+	}
+}
+
+func TestVPTreeLinear(t *testing.T) {
+	// The squared hamming distance doesn't hold to the triangle inequality, 0b00 and 0b11 are
+	// 4 apart but only 1 away from 0b01, so a pruned tree can miss matches
+	squared := func(a, b []uint64) float64 {
+		d := hash.HammingDistance(a, b)
+		return d * d
+	}
+	var samples []*Item
+	for i := range 500 {
+		samples = append(samples, &Item{ID: uint(i + 1), Hashes: []uint64{uint64(rand.Intn(0xffff))}})
+	}
+	target := *samples[rand.Intn(len(samples))]
+	radius := 16.0
+
+	var expected []uint
+	for _, item := range samples {
+		if item.ID != target.ID && squared(target.Hashes, item.Hashes) < radius {
+			expected = append(expected, item.ID)
+		}
+	}
+	found, _ := NewLinear(samples, squared).Within(target, radius)
+	var ids []uint
+	for _, f := range found {
+		ids = append(ids, f.ID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, expected) {
+		t.Errorf("A linear tree found %v but expected %v", ids, expected)
+	}
+
+	if tree := NewForHasher(samples, hash.RADISH); !tree.linear {
+		t.Error("A tree for a hasher that isn't a metric should be searched linearly")
+	}
+}